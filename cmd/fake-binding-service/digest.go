@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const maxNonces = 10000
+
+// digestAuth checks HTTP digest authentication (RFC 2617, MD5 with qop=auth) like the binding service does
+type digestAuth struct {
+	realm    string
+	username string
+	password string
+
+	mu     sync.Mutex
+	nonces map[string]bool
+}
+
+func newDigestAuth(realm, username, password string) *digestAuth {
+	return &digestAuth{realm: realm, username: username, password: password, nonces: map[string]bool{}}
+}
+
+func (a *digestAuth) Require(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.verify(r) {
+			a.challenge(w)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (a *digestAuth) challenge(w http.ResponseWriter) {
+	nonce := a.newNonce()
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", nonce="%s", algorithm=MD5, qop="auth"`, a.realm, nonce))
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (a *digestAuth) newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	//forget old nonces rather than growing forever, clients are challenged again
+	if len(a.nonces) >= maxNonces {
+		a.nonces = map[string]bool{}
+	}
+	a.nonces[nonce] = true
+	return nonce
+}
+
+func (a *digestAuth) knownNonce(nonce string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.nonces[nonce]
+}
+
+func (a *digestAuth) verify(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Digest ") {
+		return false
+	}
+	params := parseDigestParams(strings.TrimPrefix(header, "Digest "))
+	if params["username"] != a.username || params["realm"] != a.realm || !a.knownNonce(params["nonce"]) {
+		return false
+	}
+
+	ha1 := md5Hex(a.username + ":" + a.realm + ":" + a.password)
+	ha2 := md5Hex(r.Method + ":" + params["uri"])
+	var expected string
+	switch params["qop"] {
+	case "auth":
+		expected = md5Hex(strings.Join([]string{ha1, params["nonce"], params["nc"], params["cnonce"], "auth", ha2}, ":"))
+	case "":
+		expected = md5Hex(ha1 + ":" + params["nonce"] + ":" + ha2)
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(params["response"])) == 1
+}
+
+// parseDigestParams splits the comma separated key=value pairs of a digest header, values being optionally quoted
+func parseDigestParams(s string) map[string]string {
+	params := map[string]string{}
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value = s[1 : end+1]
+			s = s[end+2:]
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
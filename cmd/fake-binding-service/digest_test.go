@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func digestHeader(username, password, realm, nonce, method, uri string) string {
+	ha1 := md5Hex(username + ":" + realm + ":" + password)
+	ha2 := md5Hex(method + ":" + uri)
+	response := md5Hex(strings.Join([]string{ha1, nonce, "00000001", "0a4f113b", "auth", ha2}, ":"))
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", qop=auth, nc=00000001, cnonce="0a4f113b", response="%s"`,
+		username, realm, nonce, uri, response)
+}
+
+func TestDigestAuth(t *testing.T) {
+	a := newDigestAuth("binding-service", "upp", "secret")
+	h := a.Require(func(w http.ResponseWriter, r *http.Request) {})
+	uri := "/metadata-services/binding/1.0/sources/METHODE/references/0cd42702-f789-11e6-9516-2d969e0d3b65"
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", uri, nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Unauthenticated request should be challenged")
+	challenge := parseDigestParams(strings.TrimPrefix(w.Header().Get("WWW-Authenticate"), "Digest "))
+	assert.Equal(t, "binding-service", challenge["realm"], "Unexpected realm")
+	assert.Equal(t, "auth", challenge["qop"], "Unexpected qop")
+	nonce := challenge["nonce"]
+	assert.NotEmpty(t, nonce, "Challenge should contain a nonce")
+
+	req := httptest.NewRequest("GET", uri, nil)
+	req.Header.Set("Authorization", digestHeader("upp", "secret", "binding-service", nonce, "GET", uri))
+	w = httptest.NewRecorder()
+	h(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "Valid digest should be accepted")
+
+	req = httptest.NewRequest("GET", uri, nil)
+	req.Header.Set("Authorization", digestHeader("upp", "wrong", "binding-service", nonce, "GET", uri))
+	w = httptest.NewRecorder()
+	h(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Wrong password should be refused")
+
+	req = httptest.NewRequest("GET", uri, nil)
+	req.Header.Set("Authorization", digestHeader("upp", "secret", "binding-service", "unknown", "GET", uri))
+	w = httptest.NewRecorder()
+	h(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Nonce not issued by the server should be refused")
+}
+
+func TestHasNoMetadataIsStable(t *testing.T) {
+	uuid := "0cd42702-f789-11e6-9516-2d969e0d3b65"
+	assert.Equal(t, hasNoMetadata(uuid, 50), hasNoMetadata(uuid, 50), "The same UUID should always get the same answer")
+	assert.False(t, hasNoMetadata(uuid, 0), "No UUID should lack metadata at 0 percent")
+	assert.True(t, hasNoMetadata(uuid, 100), "Every UUID should lack metadata at 100 percent")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+)
+
+const bindingServicePath = "/metadata-services/binding/1.0/sources/{source}/references/{uuid}"
+
+// bindingService emulates the binding service for rehearsing backfills locally
+type bindingService struct {
+	metadata          []byte
+	noMetadataPercent int
+	errorPercent      int
+	errorStatus       int
+	latency           time.Duration
+	jitter            time.Duration
+}
+
+func main() {
+	app := cli.App("fake-binding-service", "Emulates the binding service for rehearsing backfills")
+
+	port := app.Int(cli.IntOpt{
+		Name:   "port",
+		Value:  8081,
+		Desc:   "Port to listen on",
+		EnvVar: "PORT",
+	})
+
+	credentials := app.String(cli.StringOpt{
+		Name:   "credentials",
+		Value:  "upp:upp",
+		Desc:   "Username and password required with digest auth, as username:password (no authentication if empty)",
+		EnvVar: "CREDENTIALS",
+	})
+
+	fixture := app.String(cli.StringOpt{
+		Name:   "fixture",
+		Value:  "metadata/resources/metadata-response.xml",
+		Desc:   "XML file returned as the metadata of every content item",
+		EnvVar: "FIXTURE",
+	})
+
+	noMetadataPercent := app.Int(cli.IntOpt{
+		Name:   "noMetadataPercent",
+		Value:  10,
+		Desc:   "Percentage of UUIDs without metadata (204), always the same UUIDs",
+		EnvVar: "NO_METADATA_PERCENT",
+	})
+
+	errorPercent := app.Int(cli.IntOpt{
+		Name:   "errorPercent",
+		Value:  0,
+		Desc:   "Percentage of requests failing at random",
+		EnvVar: "ERROR_PERCENT",
+	})
+
+	errorStatus := app.Int(cli.IntOpt{
+		Name:   "errorStatus",
+		Value:  http.StatusInternalServerError,
+		Desc:   "Status code of the failing requests",
+		EnvVar: "ERROR_STATUS",
+	})
+
+	latency := app.String(cli.StringOpt{
+		Name:   "latency",
+		Value:  "50ms",
+		Desc:   "Time taken to answer each request",
+		EnvVar: "LATENCY",
+	})
+
+	jitter := app.String(cli.StringOpt{
+		Name:   "jitter",
+		Value:  "0s",
+		Desc:   "Maximum random time added to the latency",
+		EnvVar: "JITTER",
+	})
+
+	app.Action = func() {
+		metadata, err := ioutil.ReadFile(*fixture)
+		if err != nil {
+			log.WithError(err).Error("Cannot read fixture")
+			cli.Exit(1)
+		}
+		bs := &bindingService{
+			metadata:          metadata,
+			noMetadataPercent: *noMetadataPercent,
+			errorPercent:      *errorPercent,
+			errorStatus:       *errorStatus,
+		}
+		bs.latency, err = time.ParseDuration(*latency)
+		if err != nil {
+			log.WithError(err).Error("Invalid latency")
+			cli.Exit(1)
+		}
+		bs.jitter, err = time.ParseDuration(*jitter)
+		if err != nil {
+			log.WithError(err).Error("Invalid jitter")
+			cli.Exit(1)
+		}
+
+		handler := bs.serve
+		if *credentials != "" {
+			auth := strings.SplitN(*credentials, ":", 2)
+			if len(auth) != 2 {
+				log.Error("Credentials must be given as username:password")
+				cli.Exit(1)
+			}
+			handler = newDigestAuth("binding-service", auth[0], auth[1]).Require(handler)
+		}
+
+		r := mux.NewRouter()
+		r.HandleFunc(bindingServicePath, handler).Methods("GET")
+		log.WithField("port", *port).Info("Fake binding service listening")
+		err = http.ListenAndServe(":"+strconv.Itoa(*port), r)
+		if err != nil {
+			log.WithError(err).Error("HTTP server stopped")
+		}
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.WithError(err).Error("Cannot start application")
+	}
+}
+
+func (bs *bindingService) serve(w http.ResponseWriter, r *http.Request) {
+	uuid := mux.Vars(r)["uuid"]
+	delay := bs.latency
+	if bs.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(bs.jitter)))
+	}
+	time.Sleep(delay)
+
+	logger := log.WithFields(log.Fields{"uuid": uuid, "source": mux.Vars(r)["source"]})
+	switch {
+	case rand.Intn(100) < bs.errorPercent:
+		logger.WithField("status_code", bs.errorStatus).Info("Injected failure")
+		w.WriteHeader(bs.errorStatus)
+	case hasNoMetadata(uuid, bs.noMetadataPercent):
+		logger.WithField("status_code", http.StatusNoContent).Info("No metadata")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		logger.WithField("status_code", http.StatusOK).Info("Metadata served")
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(bs.metadata)
+	}
+}
+
+// hasNoMetadata picks the UUIDs without metadata by their hash, so that a rerun sees the same ones
+func hasNoMetadata(uuid string, percent int) bool {
+	return int(crc32.ChecksumIEEE([]byte(uuid))%100) < percent
+}
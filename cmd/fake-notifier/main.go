@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+)
+
+// notification is what gets recorded of every publish received, with the payload to compare runs
+type notification struct {
+	UUID         string            `json:"uuid"`
+	LastModified string            `json:"lastModified"`
+	Size         int               `json:"size"`
+	Value        []byte            `json:"value,omitempty"`
+	Annotations  []json.RawMessage `json:"annotations,omitempty"`
+	// SHA256 is the hash of the value, or of the annotations JSON when there is no value
+	SHA256     string    `json:"sha256"`
+	TID        string    `json:"tid"`
+	Status     int       `json:"status"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// notifier emulates the cms-metadata-notifier for rehearsing backfills locally
+type notifier struct {
+	username     string
+	password     string
+	status       int
+	errorPercent int
+	errorStatus  int
+	latency      time.Duration
+
+	mu       sync.Mutex
+	record   io.Writer
+	received int
+	statuses map[int]int
+}
+
+func main() {
+	app := cli.App("fake-notifier", "Emulates the cms-metadata-notifier for rehearsing backfills")
+
+	port := app.Int(cli.IntOpt{
+		Name:   "port",
+		Value:  8082,
+		Desc:   "Port to listen on",
+		EnvVar: "PORT",
+	})
+
+	credentials := app.String(cli.StringOpt{
+		Name:   "credentials",
+		Value:  "upp:upp",
+		Desc:   "Username and password required with basic auth, as username:password (no authentication if empty)",
+		EnvVar: "CREDENTIALS",
+	})
+
+	recordFile := app.String(cli.StringOpt{
+		Name:   "recordFile",
+		Value:  "notifications.jsonl",
+		Desc:   "File where every received publish is appended as a JSON line (not recorded if empty)",
+		EnvVar: "RECORD_FILE",
+	})
+
+	status := app.Int(cli.IntOpt{
+		Name:   "status",
+		Value:  http.StatusOK,
+		Desc:   "Status code of the responses",
+		EnvVar: "STATUS",
+	})
+
+	errorPercent := app.Int(cli.IntOpt{
+		Name:   "errorPercent",
+		Value:  0,
+		Desc:   "Percentage of requests failing at random",
+		EnvVar: "ERROR_PERCENT",
+	})
+
+	errorStatus := app.Int(cli.IntOpt{
+		Name:   "errorStatus",
+		Value:  http.StatusServiceUnavailable,
+		Desc:   "Status code of the failing requests",
+		EnvVar: "ERROR_STATUS",
+	})
+
+	latency := app.String(cli.StringOpt{
+		Name:   "latency",
+		Value:  "20ms",
+		Desc:   "Time taken to answer each request",
+		EnvVar: "LATENCY",
+	})
+
+	app.Action = func() {
+		n := &notifier{
+			status:       *status,
+			errorPercent: *errorPercent,
+			errorStatus:  *errorStatus,
+			statuses:     map[int]int{},
+		}
+		var err error
+		n.latency, err = time.ParseDuration(*latency)
+		if err != nil {
+			log.WithError(err).Error("Invalid latency")
+			cli.Exit(1)
+		}
+		if *credentials != "" {
+			auth := strings.SplitN(*credentials, ":", 2)
+			if len(auth) != 2 {
+				log.Error("Credentials must be given as username:password")
+				cli.Exit(1)
+			}
+			n.username, n.password = auth[0], auth[1]
+		}
+		if *recordFile != "" {
+			f, err := os.OpenFile(*recordFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				log.WithError(err).Error("Cannot open record file")
+				cli.Exit(1)
+			}
+			defer f.Close()
+			n.record = f
+		}
+
+		r := mux.NewRouter()
+		r.HandleFunc("/notify", n.notify).Methods("POST")
+		r.HandleFunc("/__cms-metadata-notifier/notify", n.notify).Methods("POST")
+		r.HandleFunc("/__stats", n.stats).Methods("GET")
+		log.WithField("port", *port).Info("Fake notifier listening")
+		err = http.ListenAndServe(":"+strconv.Itoa(*port), r)
+		if err != nil {
+			log.WithError(err).Error("HTTP server stopped")
+		}
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.WithError(err).Error("Cannot start application")
+	}
+}
+
+func (n *notifier) authenticated(r *http.Request) bool {
+	if n.username == "" {
+		return true
+	}
+	username, password, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(n.username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(n.password)) == 1
+}
+
+func (n *notifier) notify(w http.ResponseWriter, r *http.Request) {
+	if !n.authenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="cms-metadata-notifier"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		UUID         string            `json:"uuid"`
+		LastModified string            `json:"lastModified"`
+		Value        []byte            `json:"value"`
+		Annotations  []json.RawMessage `json:"annotations"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		log.WithError(err).Warning("Invalid publish request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	time.Sleep(n.latency)
+
+	status := n.status
+	if rand.Intn(100) < n.errorPercent {
+		status = n.errorStatus
+	}
+	m := notification{
+		UUID:         body.UUID,
+		LastModified: body.LastModified,
+		Size:         len(body.Value),
+		Value:        body.Value,
+		Annotations:  body.Annotations,
+		SHA256:       payloadHash(body.Value, body.Annotations),
+		TID:          fmt.Sprintf("tid_fake%d", time.Now().UnixNano()),
+		Status:       status,
+		ReceivedAt:   time.Now(),
+	}
+	n.save(m)
+
+	log.WithFields(log.Fields{"uuid": m.UUID, "tid": m.TID, "status_code": status, "size": m.Size}).Info("Publish received")
+	w.Header().Set("X-Request-Id", m.TID)
+	w.WriteHeader(status)
+}
+
+func payloadHash(value []byte, annotations []json.RawMessage) string {
+	payload := value
+	if len(payload) == 0 && annotations != nil {
+		payload, _ = json.Marshal(annotations)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(payload))
+}
+
+func (n *notifier) save(m notification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.received++
+	n.statuses[m.Status]++
+	if n.record == nil {
+		return
+	}
+	err := json.NewEncoder(n.record).Encode(m)
+	if err != nil {
+		log.WithError(err).Error("Cannot record publish")
+	}
+}
+
+// stats reports how many publishes were received, by status code
+func (n *notifier) stats(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	statuses := map[string]int{}
+	for status, count := range n.statuses {
+		statuses[strconv.Itoa(status)] = count
+	}
+	stats := map[string]interface{}{"received": n.received, "statuses": statuses}
+	n.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const publishBody = `{"uuid": "0cd42702-f789-11e6-9516-2d969e0d3b65", "lastModified": "2017-02-20T10:00:00Z", "value": "PG1ldGFkYXRhLz4="}`
+
+func newTestNotifier(record *bytes.Buffer) *notifier {
+	return &notifier{
+		username:    "upp",
+		password:    "secret",
+		status:      http.StatusOK,
+		errorStatus: http.StatusServiceUnavailable,
+		record:      record,
+		statuses:    map[int]int{},
+	}
+}
+
+func publishRequest(body string, username, password string) *http.Request {
+	req := httptest.NewRequest("POST", "/notify", strings.NewReader(body))
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	return req
+}
+
+func TestNotifyRequiresBasicAuth(t *testing.T) {
+	n := newTestNotifier(&bytes.Buffer{})
+
+	w := httptest.NewRecorder()
+	n.notify(w, publishRequest(publishBody, "", ""))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Unauthenticated request should be refused")
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Basic", "Expecting a basic auth challenge")
+
+	w = httptest.NewRecorder()
+	n.notify(w, publishRequest(publishBody, "upp", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Wrong password should be refused")
+
+	w = httptest.NewRecorder()
+	n.notify(w, publishRequest(publishBody, "upp", "secret"))
+	assert.Equal(t, http.StatusOK, w.Code, "Valid credentials should be accepted")
+	assert.Equal(t, 1, n.received, "Only the authenticated publish should be counted")
+}
+
+func TestNotifyWithoutCredentials(t *testing.T) {
+	n := newTestNotifier(&bytes.Buffer{})
+	n.username, n.password = "", ""
+
+	w := httptest.NewRecorder()
+	n.notify(w, publishRequest(publishBody, "", ""))
+	assert.Equal(t, http.StatusOK, w.Code, "No authentication should be required without credentials")
+}
+
+func TestNotifyAnswersConfiguredStatus(t *testing.T) {
+	n := newTestNotifier(&bytes.Buffer{})
+	n.status = http.StatusAccepted
+
+	w := httptest.NewRecorder()
+	n.notify(w, publishRequest(publishBody, "upp", "secret"))
+	assert.Equal(t, http.StatusAccepted, w.Code, "Unexpected status code")
+	assert.NotEmpty(t, w.Header().Get("X-Request-Id"), "Expecting a transaction ID")
+
+	n.errorPercent = 100
+	w = httptest.NewRecorder()
+	n.notify(w, publishRequest(publishBody, "upp", "secret"))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "Expecting the error status for failing requests")
+
+	w = httptest.NewRecorder()
+	n.stats(w, httptest.NewRequest("GET", "/__stats", nil))
+	var stats struct {
+		Received int            `json:"received"`
+		Statuses map[string]int `json:"statuses"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&stats), "Failed to decode stats")
+	assert.Equal(t, 2, stats.Received, "Unexpected number of received publishes")
+	assert.Equal(t, map[string]int{"202": 1, "503": 1}, stats.Statuses, "Unexpected counts by status code")
+}
+
+func TestNotifyRecordsPayload(t *testing.T) {
+	record := &bytes.Buffer{}
+	n := newTestNotifier(record)
+
+	w := httptest.NewRecorder()
+	n.notify(w, publishRequest(publishBody, "upp", "secret"))
+	annotationsBody := `{"uuid": "0cd42702-f789-11e6-9516-2d969e0d3b66", "annotations": [{"predicate": "about"}]}`
+	w = httptest.NewRecorder()
+	n.notify(w, publishRequest(annotationsBody, "upp", "secret"))
+
+	decoder := json.NewDecoder(record)
+	var m notification
+	assert.NoError(t, decoder.Decode(&m), "Failed to decode recorded publish")
+	assert.Equal(t, "0cd42702-f789-11e6-9516-2d969e0d3b65", m.UUID, "Unexpected uuid")
+	assert.Equal(t, "2017-02-20T10:00:00Z", m.LastModified, "Unexpected lastModified")
+	assert.Equal(t, []byte("<metadata/>"), m.Value, "Unexpected recorded value")
+	assert.Equal(t, len("<metadata/>"), m.Size, "Unexpected size")
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte("<metadata/>"))), m.SHA256, "Unexpected payload hash")
+	assert.Equal(t, http.StatusOK, m.Status, "Unexpected recorded status")
+	assert.NotEmpty(t, m.TID, "Expecting a recorded transaction ID")
+
+	m = notification{}
+	assert.NoError(t, decoder.Decode(&m), "Failed to decode recorded publish")
+	assert.Empty(t, m.Value, "Unexpected recorded value")
+	assert.Len(t, m.Annotations, 1, "Unexpected recorded annotations")
+	assert.JSONEq(t, `{"predicate": "about"}`, string(m.Annotations[0]), "Unexpected recorded annotation")
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte(`[{"predicate":"about"}]`))), m.SHA256, "Unexpected payload hash")
+}
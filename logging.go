@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+type logConfig struct {
+	output      string
+	errorOutput string
+	level       string
+	format      string
+	maxSize     int
+	maxBackups  int
+}
+
+func initLogging(c logConfig) error {
+	level, err := log.ParseLevel(c.level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+
+	switch c.format {
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	case "text":
+		log.SetFormatter(&log.TextFormatter{TimestampFormat: time.RFC3339Nano, FullTimestamp: true})
+	default:
+		return fmt.Errorf("Invalid log format %q", c.format)
+	}
+
+	out, err := openLogOutput(c.output, c.maxSize, c.maxBackups)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(out)
+
+	if c.errorOutput != "" {
+		errorOut, err := openLogOutput(c.errorOutput, c.maxSize, c.maxBackups)
+		if err != nil {
+			return err
+		}
+		log.AddHook(&errorOutputHook{out: errorOut})
+	}
+	return nil
+}
+
+// openLogOutput returns stdout, stderr or the given file, rotated once it reaches maxSize megabytes
+func openLogOutput(destination string, maxSize int, maxBackups int) (io.Writer, error) {
+	switch destination {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	case "":
+		return nil, fmt.Errorf("Empty log destination")
+	}
+
+	//fail early if the file cannot be written, e.g. on a read-only filesystem
+	f, err := os.OpenFile(destination, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 {
+		return f, nil
+	}
+	f.Close()
+	return &lumberjack.Logger{Filename: destination, MaxSize: maxSize, MaxBackups: maxBackups}, nil
+}
+
+// errorOutputHook additionally writes errors to a separate destination
+type errorOutputHook struct {
+	out io.Writer
+}
+
+func (h *errorOutputHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel}
+}
+
+func (h *errorOutputHook) Fire(entry *log.Entry) error {
+	line, err := entry.Logger.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	_, err = h.out.Write(line)
+	return err
+}
@@ -2,18 +2,20 @@ package main
 
 import (
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/Financial-Times/v1-metadata-publisher/metadata"
-	"github.com/op/go-logging"
+	log "github.com/sirupsen/logrus"
 	"github.com/jawher/mow.cli"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
-)
-
-var log = logging.MustGetLogger("v1-metadata-publisher.log")
-var format = logging.MustStringFormatter(
-	`%{color}%{time:15:04:05.000} %{shortfunc}: %{level:.4s} %{message}`,
+	"time"
 )
 
 func main() {
@@ -26,6 +28,32 @@ func main() {
 		EnvVar: "DELIVERY_CLUSTER",
 	})
 
+	mongoDatabase := app.String(cli.StringOpt{
+		Name:   "mongoDatabase",
+		Value:  "upp-store",
+		Desc:   "Database with the content",
+		EnvVar: "MONGO_DATABASE",
+	})
+
+	mongoCollection := app.String(cli.StringOpt{
+		Name:   "mongoCollection",
+		Value:  "content",
+		Desc:   "Collection with the content",
+		EnvVar: "MONGO_COLLECTION",
+	})
+
+	mongoQuery := app.String(cli.StringOpt{
+		Name:   "mongoQuery",
+		Desc:   "JSON query selecting the content to publish, before filtering by source (default {\"mediaType\": null})",
+		EnvVar: "MONGO_QUERY",
+	})
+
+	mongoIndexHint := app.String(cli.StringOpt{
+		Name:   "mongoIndexHint",
+		Desc:   "Comma separated key fields of the index to scan the content with, e.g. identifiers.authority (chosen by Mongo if empty)",
+		EnvVar: "MONGO_INDEX_HINT",
+	})
+
 	publishingCluster := app.String(cli.StringOpt{
 		Name:   "publishingCluster",
 		Value:  "http://localhost:8080",
@@ -39,6 +67,20 @@ func main() {
 		EnvVar: "PUBLISHING_CLUSTER_CREDENTIALS",
 	})
 
+	publishingClusterAuth := app.String(cli.StringOpt{
+		Name:   "publishingClusterAuth",
+		Value:  metadata.AuthBasic,
+		Desc:   "Authentication to the publishing cluster: none, basic, digest, bearer or apikey",
+		EnvVar: "PUBLISHING_CLUSTER_AUTH",
+	})
+
+	publishingClusterAPIKeyHeader := app.String(cli.StringOpt{
+		Name:   "publishingClusterApiKeyHeader",
+		Value:  "X-Api-Key",
+		Desc:   "Header carrying the API key with apikey authentication to the publishing cluster",
+		EnvVar: "PUBLISHING_CLUSTER_API_KEY_HEADER",
+	})
+
 	cmrAddress := app.String(cli.StringOpt{
 		Name:   "cmrAddress",
 		Value:  "http://localhost:8080",
@@ -46,12 +88,32 @@ func main() {
 		EnvVar: "CMR_ADDRESS",
 	})
 
+	cmrSourceAddresses := app.String(cli.StringOpt{
+		Name:   "cmrSourceAddresses",
+		Desc:   "JSON object with the metadata URL templates of the sources not read from cmrAddress, e.g. {\"BLOGS\": \"http://host/{systemCode}/{identifierValue}\"}",
+		EnvVar: "CMR_SOURCE_ADDRESSES",
+	})
+
 	cmrCredentials := app.String(cli.StringOpt{
 		Name:   "cmrCredentials",
 		Desc:   "Credentials for Central Metadata Repository",
 		EnvVar: "CMR_CREDENTIALS",
 	})
 
+	cmrAuth := app.String(cli.StringOpt{
+		Name:   "cmrAuth",
+		Value:  metadata.AuthDigest,
+		Desc:   "Authentication to the Central Metadata Repository: none, basic, digest, bearer or apikey",
+		EnvVar: "CMR_AUTH",
+	})
+
+	cmrAPIKeyHeader := app.String(cli.StringOpt{
+		Name:   "cmrApiKeyHeader",
+		Value:  "X-Api-Key",
+		Desc:   "Header carrying the API key with apikey authentication to the Central Metadata Repository",
+		EnvVar: "CMR_API_KEY_HEADER",
+	})
+
 	source := app.String(cli.StringOpt{
 		Name:   "source",
 		Value:  "METHODE",
@@ -66,66 +128,492 @@ func main() {
 		EnvVar: "BATCH_SIZE",
 	})
 
-	initLogging()
+	maxConcurrency := app.Int(cli.IntOpt{
+		Name:   "maxConcurrency",
+		Value:  0,
+		Desc:   "Maximum number of concurrent binding-service requests (0 means the batch size)",
+		EnvVar: "MAX_CONCURRENCY",
+	})
+
+	publishRate := app.Int(cli.IntOpt{
+		Name:   "publishRate",
+		Value:  0,
+		Desc:   "Number of publishes to be sent / second (0 means no limit)",
+		EnvVar: "PUBLISH_RATE",
+	})
+
+	publishConcurrency := app.Int(cli.IntOpt{
+		Name:   "publishConcurrency",
+		Value:  0,
+		Desc:   "Maximum number of concurrent publishes (0 means the same as maxConcurrency)",
+		EnvVar: "PUBLISH_CONCURRENCY",
+	})
+
+	queueSize := app.Int(cli.IntOpt{
+		Name:   "queueSize",
+		Value:  1000,
+		Desc:   "Number of content items queued between the scan, read and publish stages",
+		EnvVar: "QUEUE_SIZE",
+	})
+
+	rateLimitsFile := app.String(cli.StringOpt{
+		Name:   "rateLimitsFile",
+		Desc:   "JSON file with batchSize and maxConcurrency, reloaded on SIGHUP",
+		EnvVar: "RATE_LIMITS_FILE",
+	})
+
+	autoStart := app.Bool(cli.BoolOpt{
+		Name:   "autoStart",
+		Value:  true,
+		Desc:   "Start a backfill for the configured source when the application starts",
+		EnvVar: "AUTO_START",
+	})
+
+	preCount := app.Bool(cli.BoolOpt{
+		Name:   "preCount",
+		Value:  false,
+		Desc:   "Count the matching content before starting the backfill, to show progress as a percentage with an ETA",
+		EnvVar: "PRE_COUNT",
+	})
+
+	expectedCount := app.Int(cli.IntOpt{
+		Name:   "expectedCount",
+		Value:  0,
+		Desc:   "Expected number of matching content items; with preCount the backfill does not start if the count differs too much",
+		EnvVar: "EXPECTED_COUNT",
+	})
+
+	maxCountDeviation := app.Int(cli.IntOpt{
+		Name:   "maxCountDeviation",
+		Value:  metadata.DefaultMaxCountDeviation,
+		Desc:   "Maximum difference in percent between the counted and the expected number of content items",
+		EnvVar: "MAX_COUNT_DEVIATION",
+	})
+
+	readRetries := app.Int(cli.IntOpt{
+		Name:   "readRetries",
+		Value:  3,
+		Desc:   "Number of times a binding-service read failing with a timeout, a 5xx or a 429 is retried",
+		EnvVar: "READ_RETRIES",
+	})
+
+	readRetryBackoff := app.String(cli.StringOpt{
+		Name:   "readRetryBackoff",
+		Value:  "1s",
+		Desc:   "Wait before the first retry of a read, doubled for every next one",
+		EnvVar: "READ_RETRY_BACKOFF",
+	})
+
+	circuitBreakerThreshold := app.Int(cli.IntOpt{
+		Name:   "circuitBreakerThreshold",
+		Value:  20,
+		Desc:   "Number of consecutive failed reads after which reads are paused (0 disables the circuit breaker)",
+		EnvVar: "CIRCUIT_BREAKER_THRESHOLD",
+	})
+
+	circuitBreakerCooldown := app.String(cli.StringOpt{
+		Name:   "circuitBreakerCooldown",
+		Value:  "30s",
+		Desc:   "How long reads are paused before probing the binding service again",
+		EnvVar: "CIRCUIT_BREAKER_COOLDOWN",
+	})
+
+	metadataSchemaFile := app.String(cli.StringOpt{
+		Name:   "metadataSchemaFile",
+		Desc:   "JSON file with additional rules the metadata must follow to be published",
+		EnvVar: "METADATA_SCHEMA_FILE",
+	})
+
+	payloadFormat := app.String(cli.StringOpt{
+		Name:   "payloadFormat",
+		Value:  metadata.PayloadXML,
+		Desc:   "What is published: xml for the binding-service XML as it is, annotations for UPP annotations transformed from it",
+		EnvVar: "PAYLOAD_FORMAT",
+	})
+
+	metadataCacheDir := app.String(cli.StringOpt{
+		Name:   "metadataCacheDir",
+		Desc:   "Directory where binding-service responses are cached (disabled if empty)",
+		EnvVar: "METADATA_CACHE_DIR",
+	})
+
+	metadataCacheTTL := app.String(cli.StringOpt{
+		Name:   "metadataCacheTTL",
+		Value:  "1h",
+		Desc:   "How long cached binding-service responses are used",
+		EnvVar: "METADATA_CACHE_TTL",
+	})
+
+	metadataCacheBypass := app.Bool(cli.BoolOpt{
+		Name:   "metadataCacheBypass",
+		Value:  false,
+		Desc:   "Read all metadata from the binding service, refreshing the cache",
+		EnvVar: "METADATA_CACHE_BYPASS",
+	})
+
+	apiCredentialsFile := app.String(cli.StringOpt{
+		Name:   "apiCredentialsFile",
+		Desc:   "JSON file with the API keys and basic auth users allowed to call the HTTP API",
+		EnvVar: "API_CREDENTIALS_FILE",
+	})
+
+	insecureAPI := app.Bool(cli.BoolOpt{
+		Name:   "insecureAPI",
+		Value:  false,
+		Desc:   "Serve the HTTP API without authentication when there is no API credentials file, e.g. for local runs",
+		EnvVar: "INSECURE_API",
+	})
+
+	ledgerPath := app.String(cli.StringOpt{
+		Name:   "ledgerPath",
+		Desc:   "Path of the database recording every publish attempt (disabled if empty)",
+		EnvVar: "LEDGER_PATH",
+	})
+
+	app.Command("history", "Show the recorded publish attempts for a content item", func(cmd *cli.Cmd) {
+		uuid := cmd.StringArg("UUID", "", "UUID of the content")
+		cmd.Action = func() {
+			printHistory(*ledgerPath, *uuid)
+		}
+	})
+
+	app.Command("transform", "Print the UPP annotations transformed from binding-service XML", func(cmd *cli.Cmd) {
+		cmd.Spec = "[FILE]"
+		file := cmd.StringArg("FILE", "-", "File with the XML, - for standard input")
+		cmd.Action = func() {
+			printAnnotations(*file)
+		}
+	})
+
+	logOutput := app.String(cli.StringOpt{
+		Name:   "logOutput",
+		Value:  "stdout",
+		Desc:   "Where to write logs: stdout, stderr or a file path",
+		EnvVar: "LOG_OUTPUT",
+	})
+
+	logErrorOutput := app.String(cli.StringOpt{
+		Name:   "logErrorOutput",
+		Desc:   "Where to additionally write errors: stdout, stderr or a file path (optional)",
+		EnvVar: "LOG_ERROR_OUTPUT",
+	})
+
+	logLevel := app.String(cli.StringOpt{
+		Name:   "logLevel",
+		Value:  "info",
+		Desc:   "Log level: debug, info, warning or error",
+		EnvVar: "LOG_LEVEL",
+	})
+
+	logFormat := app.String(cli.StringOpt{
+		Name:   "logFormat",
+		Value:  "json",
+		Desc:   "Log format: json or text",
+		EnvVar: "LOG_FORMAT",
+	})
+
+	logMaxSize := app.Int(cli.IntOpt{
+		Name:   "logMaxSize",
+		Value:  100,
+		Desc:   "Size in megabytes after which log files are rotated (0 disables rotation)",
+		EnvVar: "LOG_MAX_SIZE",
+	})
+
+	logMaxBackups := app.Int(cli.IntOpt{
+		Name:   "logMaxBackups",
+		Value:  5,
+		Desc:   "Number of rotated log files to keep (0 keeps all)",
+		EnvVar: "LOG_MAX_BACKUPS",
+	})
 
 	app.Action = func() {
+		err := initLogging(logConfig{
+			output:      *logOutput,
+			errorOutput: *logErrorOutput,
+			level:       *logLevel,
+			format:      *logFormat,
+			maxSize:     *logMaxSize,
+			maxBackups:  *logMaxBackups,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot initialise logging: %s\n", err)
+			cli.Exit(1)
+		}
+
+		var auth *metadata.Authenticator
+		if *apiCredentialsFile != "" {
+			auth, err = metadata.LoadCredentials(*apiCredentialsFile)
+			if err != nil {
+				log.WithError(err).Error("Cannot start application")
+				return
+			}
+		} else if *insecureAPI {
+			log.Warning("No API credentials file configured, the HTTP API is not authenticated")
+		} else {
+			log.Error("Cannot start application: set API_CREDENTIALS_FILE, or INSECURE_API=true to serve the HTTP API without authentication")
+			return
+		}
+
 		delivery := metadata.GetCluster(*deliveryCluster, "")
 		publishing := metadata.GetCluster(*publishingCluster, *publishingClusterCredentials)
 		cmr := metadata.GetCluster(*cmrAddress, *cmrCredentials)
+		err = publishing.SetAuth(*publishingClusterAuth, *publishingClusterAPIKeyHeader)
+		if err != nil {
+			log.WithError(err).Error("Cannot start application")
+			return
+		}
+		err = cmr.SetAuth(*cmrAuth, *cmrAPIKeyHeader)
+		if err != nil {
+			log.WithError(err).Error("Cannot start application")
+			return
+		}
 
 		cmrReader, err := metadata.NewV1MetadataReadService(cmr)
 		if err != nil {
-			log.Errorf("Cannot start application: %s", err)
+			log.WithError(err).Error("Cannot start application")
 			return
 		}
+		backoff, err := time.ParseDuration(*readRetryBackoff)
+		if err != nil {
+			log.WithError(err).Error("Cannot start application")
+			return
+		}
+		cmrReader.SetRetries(*readRetries, backoff)
+		if *cmrSourceAddresses != "" {
+			var templates map[string]string
+			err = json.Unmarshal([]byte(*cmrSourceAddresses), &templates)
+			if err != nil {
+				log.WithError(err).Error("Cannot start application: invalid CMR_SOURCE_ADDRESSES")
+				return
+			}
+			err = cmrReader.SetSourceURLs(templates)
+			if err != nil {
+				log.WithError(err).Error("Cannot start application")
+				return
+			}
+		}
+		var schema *metadata.MetadataSchema
+		if *metadataSchemaFile != "" {
+			schema, err = metadata.LoadMetadataSchema(*metadataSchemaFile)
+			if err != nil {
+				log.WithError(err).Error("Cannot start application")
+				return
+			}
+			cmrReader.SetSchema(schema)
+		}
 
 		contentService, err := metadata.InitContentService(delivery)
 		if err != nil {
-			log.Errorf("Cannot start application: %s", err)
+			log.WithError(err).Error("Cannot start application")
+			return
+		}
+		err = contentService.SetStore(*mongoDatabase, *mongoCollection, *mongoQuery)
+		if err != nil {
+			log.WithError(err).Error("Cannot start application")
 			return
 		}
-		mp := metadata.NewV1MetadataPublishService(contentService, publishing, cmrReader, *source, *batchSize)
-		mp.Publish()
+		if *mongoIndexHint != "" {
+			err = contentService.SetIndexHint(*mongoIndexHint)
+			if err != nil {
+				log.WithError(err).Error("Cannot start application")
+				return
+			}
+		}
+		limits := metadata.RateLimits{
+			BatchSize:          *batchSize,
+			MaxConcurrency:     *maxConcurrency,
+			PublishRate:        *publishRate,
+			PublishConcurrency: *publishConcurrency,
+			QueueSize:          *queueSize,
+		}
+		if *rateLimitsFile != "" {
+			limits, err = metadata.LoadRateLimits(*rateLimitsFile, limits)
+			if err != nil {
+				log.WithError(err).Error("Cannot start application")
+				return
+			}
+		}
+		var reader metadata.ReadService = cmrReader
+		if *metadataCacheDir != "" {
+			ttl, err := time.ParseDuration(*metadataCacheTTL)
+			if err != nil {
+				log.WithError(err).Error("Cannot start application")
+				return
+			}
+			cache, err := metadata.NewCachedReadService(cmrReader, *metadataCacheDir, ttl, *metadataCacheBypass)
+			if err != nil {
+				log.WithError(err).Error("Cannot start application")
+				return
+			}
+			cache.SetSchema(schema)
+			reader = cache
+		}
+		mp, err := metadata.NewV1MetadataPublishService(contentService, publishing, reader, *source, limits)
+		if err != nil {
+			log.WithError(err).Error("Cannot start application")
+			return
+		}
+		reloadRateLimitsOnSignal(mp, *rateLimitsFile)
+		err = mp.SetPayloadFormat(*payloadFormat)
+		if err != nil {
+			log.WithError(err).Error("Cannot start application")
+			return
+		}
+		if *circuitBreakerThreshold > 0 {
+			cooldown, err := time.ParseDuration(*circuitBreakerCooldown)
+			if err != nil {
+				log.WithError(err).Error("Cannot start application")
+				return
+			}
+			mp.SetCircuitBreaker(*circuitBreakerThreshold, cooldown)
+		}
+		err = injectFaults(cmrReader, mp)
+		if err != nil {
+			log.WithError(err).Error("Cannot start application")
+			return
+		}
+
+		var ledger metadata.Ledger
+		if *ledgerPath != "" {
+			boltLedger, err := metadata.OpenBoltLedger(*ledgerPath, false)
+			if err != nil {
+				log.WithError(err).Error("Cannot start application")
+				return
+			}
+			defer boltLedger.Close()
+			ledger = boltLedger
+			mp.SetLedger(ledger)
+		}
+
+		bm := metadata.NewBackfillManager(mp)
+		if *autoStart {
+			_, err := bm.Start(metadata.PublishOptions{
+				PreCount:          *preCount,
+				ExpectedCount:     *expectedCount,
+				MaxCountDeviation: *maxCountDeviation,
+			})
+			if err != nil {
+				log.WithError(err).Error("Cannot start backfill")
+				return
+			}
+		}
 
-		httpHandler := metadata.NewHttpHandler(mp)
-		listen(httpHandler, 8080)
+		httpHandler := metadata.NewHttpHandler(mp, bm, contentService, ledger)
+		listen(httpHandler, auth, 8080)
 	}
 
 	err := app.Run(os.Args)
 	if err != nil {
-		log.Errorf("Cannot start application: %s", err)
+		log.WithError(err).Error("Cannot start application")
 	}
 }
 
-func initLogging() {
-	errorLog, err := os.OpenFile("v1-metadata-publisher-error.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+func printHistory(ledgerPath string, uuid string) {
+	if ledgerPath == "" {
+		fmt.Fprintln(os.Stderr, "No ledger configured, set LEDGER_PATH")
+		cli.Exit(1)
+	}
+	ledger, err := metadata.OpenBoltLedger(ledgerPath, true)
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "Cannot open ledger %s: %s\nIf the service is running, use GET /history/%s instead\n", ledgerPath, err, uuid)
+		cli.Exit(1)
 	}
+	defer ledger.Close()
 
-	infoLog, err := os.OpenFile("v1-metadata-publisher.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	history, err := ledger.History(uuid)
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "Cannot read history of %s: %s\n", uuid, err)
+		cli.Exit(1)
 	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(history)
+}
 
-	fileBackend := logging.NewLogBackend(errorLog, "", 0)
-	stdBackend := logging.NewLogBackend(infoLog, "", 0)
-
-	fileBackendFormatter := logging.NewBackendFormatter(fileBackend, format)
-	stdBackendFormatter := logging.NewBackendFormatter(stdBackend, format)
+func printAnnotations(file string) {
+	var xml []byte
+	var err error
+	if file == "-" {
+		xml, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		xml, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot read %s: %s\n", file, err)
+		cli.Exit(1)
+	}
+	annotations, err := metadata.TransformMetadata(xml)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot transform %s: %s\n", file, err)
+		cli.Exit(1)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(annotations)
+}
 
-	fileBackendLeveled := logging.AddModuleLevel(fileBackendFormatter)
-	fileBackendLeveled.SetLevel(logging.ERROR, "")
+// injectFaults installs fault-injecting transports when the INJECT_READ_FAULTS or INJECT_PUBLISH_FAULTS
+// variables described in the README are set, to rehearse failures against fake services; they are read
+// directly rather than as options to keep them out of the help of the service
+func injectFaults(mr *metadata.V1MetadataReadService, mp *metadata.V1MetadataPublishService) error {
+	if spec := os.Getenv("INJECT_READ_FAULTS"); spec != "" {
+		config, err := metadata.ParseFaultConfig(spec)
+		if err != nil {
+			return err
+		}
+		mr.InjectFaults(config)
+		log.WithField("faults", spec).Warning("Injecting faults into binding service requests")
+	}
+	if spec := os.Getenv("INJECT_PUBLISH_FAULTS"); spec != "" {
+		config, err := metadata.ParseFaultConfig(spec)
+		if err != nil {
+			return err
+		}
+		mp.InjectFaults(config)
+		log.WithField("faults", spec).Warning("Injecting faults into notifier requests")
+	}
+	return nil
+}
 
-	logging.SetBackend(fileBackendLeveled, stdBackendFormatter)
+func reloadRateLimitsOnSignal(mp *metadata.V1MetadataPublishService, path string) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	go func() {
+		for range sigs {
+			if path == "" {
+				log.Warning("Received SIGHUP but no rate limits file is configured")
+				continue
+			}
+			limits, err := metadata.LoadRateLimits(path, mp.RateLimits())
+			if err != nil {
+				log.WithError(err).Error("Cannot reload rate limits")
+				continue
+			}
+			err = mp.SetRateLimits(limits)
+			if err != nil {
+				log.WithError(err).Error("Cannot reload rate limits")
+			}
+		}
+	}()
 }
 
-func listen(h *metadata.HttpHandler, port int) {
+func listen(h *metadata.HttpHandler, auth *metadata.Authenticator, port int) {
 	r := mux.NewRouter()
-	r.HandleFunc("/metadata/publish", h.Publish).Methods("POST")
+	r.HandleFunc("/metadata/publish", auth.Require(metadata.RolePublish, h.Publish)).Methods("POST")
+	r.HandleFunc("/backfill/start", auth.Require(metadata.RolePublish, h.StartBackfill)).Methods("POST")
+	r.HandleFunc("/backfill/pause", auth.Require(metadata.RolePublish, h.PauseBackfill)).Methods("POST")
+	r.HandleFunc("/backfill/resume", auth.Require(metadata.RolePublish, h.ResumeBackfill)).Methods("POST")
+	r.HandleFunc("/backfill/cancel", auth.Require(metadata.RolePublish, h.CancelBackfill)).Methods("POST")
+	r.HandleFunc("/backfill/status", auth.Require(metadata.RoleRead, h.BackfillStatus)).Methods("GET")
+	r.HandleFunc("/rate-limits", auth.Require(metadata.RoleRead, h.GetRateLimits)).Methods("GET")
+	r.HandleFunc("/rate-limits", auth.Require(metadata.RolePublish, h.SetRateLimits)).Methods("PUT")
+	r.HandleFunc("/progress/stream", auth.Require(metadata.RoleRead, h.ProgressStream)).Methods("GET")
+	r.HandleFunc("/history/{uuid}", auth.Require(metadata.RoleRead, h.History)).Methods("GET")
+	//metrics are scraped without credentials, as documented in the README
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
 
 	err := http.ListenAndServe(":"+strconv.Itoa(port), r)
 	if err != nil {
-		log.Error(err)
+		log.WithError(err).Error("HTTP server stopped")
 	}
 }
@@ -0,0 +1,122 @@
+package metadata
+
+import (
+	"crypto/md5"
+	"fmt"
+)
+
+const (
+	// PayloadXML publishes the binding-service XML as it is, base64 encoded in the value field
+	PayloadXML = "xml"
+	// PayloadAnnotations publishes the metadata transformed into UPP annotations
+	PayloadAnnotations = "annotations"
+)
+
+const (
+	thingsURI               = "http://api.ft.com/things/"
+	relevanceScoringSystem  = "http://api.ft.com/scoringsystem/FT-RELEVANCE-SYSTEM"
+	confidenceScoringSystem = "http://api.ft.com/scoringsystem/FT-CONFIDENCE-SYSTEM"
+
+	predicateMentions                = "mentions"
+	predicateIsClassifiedBy          = "isClassifiedBy"
+	predicateIsPrimarilyClassifiedBy = "isPrimarilyClassifiedBy"
+	predicateAbout                   = "about"
+	predicateHasAuthor               = "hasAuthor"
+)
+
+// taxonomy is how the terms of a V1 taxonomy are annotated in UPP
+type taxonomy struct {
+	conceptType string
+	predicate   string
+}
+
+var taxonomies = map[string]taxonomy{
+	"Authors":          {"http://www.ft.com/ontology/person/Person", predicateHasAuthor},
+	"People":           {"http://www.ft.com/ontology/person/Person", predicateMentions},
+	"Organisations":    {"http://www.ft.com/ontology/organisation/Organisation", predicateMentions},
+	"Regions":          {"http://www.ft.com/ontology/Location", predicateMentions},
+	"Topics":           {"http://www.ft.com/ontology/Topic", predicateMentions},
+	"Sections":         {"http://www.ft.com/ontology/Section", predicateIsClassifiedBy},
+	"Subjects":         {"http://www.ft.com/ontology/Subject", predicateIsClassifiedBy},
+	"Genres":           {"http://www.ft.com/ontology/Genre", predicateIsClassifiedBy},
+	"Brands":           {"http://www.ft.com/ontology/product/Brand", predicateIsClassifiedBy},
+	"SpecialReports":   {"http://www.ft.com/ontology/SpecialReport", predicateIsClassifiedBy},
+	"AlphavilleSeries": {"http://www.ft.com/ontology/AlphavilleSeries", predicateIsClassifiedBy},
+}
+
+var unknownTaxonomy = taxonomy{"http://www.ft.com/ontology/core/Thing", predicateMentions}
+
+// Annotation is a UPP annotation of a content item by a concept
+type Annotation struct {
+	Thing       Thing        `json:"thing"`
+	Provenances []Provenance `json:"provenances,omitempty"`
+}
+
+type Thing struct {
+	ID        string   `json:"id"`
+	PrefLabel string   `json:"prefLabel"`
+	Types     []string `json:"types"`
+	Predicate string   `json:"predicate"`
+}
+
+type Provenance struct {
+	Scores []AnnotationScore `json:"scores"`
+}
+
+type AnnotationScore struct {
+	ScoringSystem string  `json:"scoringSystem"`
+	Value         float64 `json:"value"`
+}
+
+// TransformMetadata maps the binding-service XML into UPP annotations, the primary section and theme
+// of the content being annotated with the isPrimarilyClassifiedBy and about predicates
+func TransformMetadata(metadata []byte) ([]Annotation, error) {
+	ref, err := parseMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := []Annotation{}
+	for _, tag := range ref.Tags {
+		annotation := newAnnotation(tag.Term, taxonomyOf(tag.Term).predicate)
+		annotation.Provenances = []Provenance{{Scores: []AnnotationScore{
+			{ScoringSystem: relevanceScoringSystem, Value: float64(tag.Score.Relevance) / 100},
+			{ScoringSystem: confidenceScoringSystem, Value: float64(tag.Score.Confidence) / 100},
+		}}}
+		annotations = append(annotations, annotation)
+	}
+	if ref.PrimarySection != nil {
+		annotations = append(annotations, newAnnotation(*ref.PrimarySection, predicateIsPrimarilyClassifiedBy))
+	}
+	if ref.PrimaryTheme != nil {
+		annotations = append(annotations, newAnnotation(*ref.PrimaryTheme, predicateAbout))
+	}
+	return annotations, nil
+}
+
+func taxonomyOf(term Term) taxonomy {
+	if t, ok := taxonomies[term.Taxonomy]; ok {
+		return t
+	}
+	return unknownTaxonomy
+}
+
+func newAnnotation(term Term, predicate string) Annotation {
+	return Annotation{Thing: Thing{
+		ID:        thingsURI + conceptUUID(term.ID),
+		PrefLabel: term.CanonicalName,
+		Types:     []string{taxonomyOf(term).conceptType},
+		Predicate: predicate,
+	}}
+}
+
+// conceptUUID derives the UPP UUID of a V1 term from its ID, as a name based (version 3) UUID in the nil namespace
+func conceptUUID(id string) string {
+	h := md5.New()
+	h.Write(make([]byte, 16))
+	h.Write([]byte(id))
+	sum := h.Sum(nil)
+	sum[6] = sum[6]&0x0f | 0x30
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
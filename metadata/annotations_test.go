@@ -0,0 +1,90 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransformMetadata(t *testing.T) {
+	metadata, err := getMetadata()
+	assert.NoError(t, err, "Failed to read metadata fixture")
+
+	annotations, err := TransformMetadata(metadata)
+	assert.NoError(t, err, "Failed to transform metadata")
+	assert.Equal(t, []Annotation{{
+		Thing: Thing{
+			ID:        "http://api.ft.com/things/" + conceptUUID("Q0ItMDMzNDMwOA==-QXV0aG9ycw=="),
+			PrefLabel: "Henry Foy",
+			Types:     []string{"http://www.ft.com/ontology/person/Person"},
+			Predicate: "hasAuthor",
+		},
+		Provenances: []Provenance{{Scores: []AnnotationScore{
+			{ScoringSystem: "http://api.ft.com/scoringsystem/FT-RELEVANCE-SYSTEM", Value: 0.9},
+			{ScoringSystem: "http://api.ft.com/scoringsystem/FT-CONFIDENCE-SYSTEM", Value: 0.9},
+		}}},
+	}}, annotations, "Unexpected annotations")
+}
+
+func TestTransformMetadataPrimaryFlags(t *testing.T) {
+	metadata := []byte(`<cr:contentRef xmlns:cr="` + contentRefNamespace + `" xmlns:tm="tm" xmlns:tg="tg" xmlns:b="b" cr:id="1">
+    <cr:primarySection tm:taxonomy="Sections" b:id="section-1"><tm:canonicalName>Companies</tm:canonicalName></cr:primarySection>
+    <cr:primaryTheme tm:taxonomy="Topics" b:id="topic-1"><tm:canonicalName>Brexit</tm:canonicalName></cr:primaryTheme>
+    <cr:tags>
+        <tg:tag>
+            <tg:term tm:taxonomy="Sections" b:id="section-1"><tm:canonicalName>Companies</tm:canonicalName></tg:term>
+            <tg:score tg:relevance="100" tg:confidence="50"/>
+        </tg:tag>
+        <tg:tag>
+            <tg:term tm:taxonomy="Unheard" b:id="other-1"><tm:canonicalName>Other</tm:canonicalName></tg:term>
+        </tg:tag>
+    </cr:tags>
+</cr:contentRef>`)
+
+	annotations, err := TransformMetadata(metadata)
+	assert.NoError(t, err, "Failed to transform metadata")
+	things := []Thing{}
+	for _, a := range annotations {
+		things = append(things, a.Thing)
+	}
+	section := "http://api.ft.com/things/" + conceptUUID("section-1")
+	assert.Equal(t, []Thing{
+		{ID: section, PrefLabel: "Companies", Types: []string{"http://www.ft.com/ontology/Section"}, Predicate: "isClassifiedBy"},
+		{ID: "http://api.ft.com/things/" + conceptUUID("other-1"), PrefLabel: "Other", Types: []string{"http://www.ft.com/ontology/core/Thing"}, Predicate: "mentions"},
+		{ID: section, PrefLabel: "Companies", Types: []string{"http://www.ft.com/ontology/Section"}, Predicate: "isPrimarilyClassifiedBy"},
+		{ID: "http://api.ft.com/things/" + conceptUUID("topic-1"), PrefLabel: "Brexit", Types: []string{"http://www.ft.com/ontology/Topic"}, Predicate: "about"},
+	}, things, "Unexpected annotated concepts")
+	assert.Equal(t, 1.0, annotations[0].Provenances[0].Scores[0].Value, "Unexpected relevance")
+	assert.Equal(t, 0.5, annotations[0].Provenances[0].Scores[1].Value, "Unexpected confidence")
+	assert.Empty(t, annotations[2].Provenances, "Primary flags have no scores")
+}
+
+func TestTransformMetadataInvalid(t *testing.T) {
+	_, err := TransformMetadata([]byte(maintenancePage))
+	assertInvalid(t, err, InvalidUnexpected)
+}
+
+func TestConceptUUID(t *testing.T) {
+	//version 3 UUID of "www.example.com" in the nil namespace
+	assert.Equal(t, "e1dbb77c-40ca-39dd-a59b-3973a877b11b", conceptUUID("www.example.com"), "Unexpected concept UUID")
+	assert.Regexp(t, uuidRegexp, conceptUUID("Q0ItMDMzNDMwOA==-QXV0aG9ycw=="), "Concept UUID should be a valid UUID")
+}
+
+func TestPublishAnnotations(t *testing.T) {
+	h := newHarness(t, testContents(3, methodeAuthority, 0), RateLimits{BatchSize: 5})
+	defer h.Close()
+	assert.NoError(t, h.mp.SetPayloadFormat(PayloadAnnotations), "Failed to set payload format")
+	assert.Error(t, h.mp.SetPayloadFormat("yaml"), "Expecting error for unknown payload format")
+
+	err := h.mp.PublishBackfill(NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 5}))
+	assert.NoError(t, err, "Backfill should finish without error")
+
+	received := h.notifier.received()
+	assert.Len(t, received, 3, "All contents should be published")
+	for _, m := range received {
+		assert.Empty(t, m.Value, "No XML expected with annotations payload")
+		if assert.Len(t, m.Annotations, 1, "Expecting the annotation of the fixture") {
+			assert.Equal(t, "Henry Foy", m.Annotations[0].Thing.PrefLabel, "Unexpected annotated concept")
+		}
+	}
+}
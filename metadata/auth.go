@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RoleRead    = "read"
+	RolePublish = "publish"
+
+	apiKeyHeader = "X-Api-Key"
+)
+
+// Credential is either an API key or a username and password, granting a role to the named client
+type Credential struct {
+	Name     string `json:"name"`
+	APIKey   string `json:"apiKey,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role"`
+}
+
+type Authenticator struct {
+	credentials []Credential
+}
+
+// LoadCredentials reads the credentials of the clients allowed to call the API from a JSON file
+func LoadCredentials(path string) (*Authenticator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var credentials []Credential
+	err = json.Unmarshal(data, &credentials)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid credentials file %s: %s", path, err)
+	}
+	return NewAuthenticator(credentials)
+}
+
+func NewAuthenticator(credentials []Credential) (*Authenticator, error) {
+	for i, c := range credentials {
+		if c.Name == "" {
+			return nil, fmt.Errorf("Credential %d has no name", i)
+		}
+		if c.Role != RoleRead && c.Role != RolePublish {
+			return nil, fmt.Errorf("Credential %s has invalid role %q", c.Name, c.Role)
+		}
+		if c.APIKey == "" && (c.Username == "" || c.Password == "") {
+			return nil, fmt.Errorf("Credential %s needs either an API key or a username and password", c.Name)
+		}
+	}
+	return &Authenticator{credentials: credentials}, nil
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (Credential, bool) {
+	key := r.Header.Get(apiKeyHeader)
+	username, password, hasBasicAuth := r.BasicAuth()
+	for _, c := range a.credentials {
+		if key != "" && c.APIKey != "" && secureEqual(key, c.APIKey) {
+			return c, true
+		}
+		if hasBasicAuth && c.Username != "" && secureEqual(username, c.Username) && secureEqual(password, c.Password) {
+			return c, true
+		}
+	}
+	return Credential{}, false
+}
+
+func requestLog(r *http.Request) *logrus.Entry {
+	return log.WithFields(logrus.Fields{
+		stageField:    stageAPI,
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"remote_addr": r.RemoteAddr,
+	})
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func hasRole(c Credential, role string) bool {
+	//publishing clients are also allowed to read
+	return c.Role == role || c.Role == RolePublish
+}
+
+// Require only lets through requests from clients having the given role; a nil Authenticator lets every request through
+func (a *Authenticator) Require(role string, h http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := a.authenticate(r)
+		if !ok {
+			requestLog(r).Warning("Unauthenticated request")
+			w.Header().Set("WWW-Authenticate", `Basic realm="v1-metadata-publisher"`)
+			writeJSONMessage(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		if !hasRole(c, role) {
+			requestLog(r).WithField("client", c.Name).Warningf("Request denied, role %s required", role)
+			writeJSONMessage(w, http.StatusForbidden, fmt.Sprintf("Role %s required", role))
+			return
+		}
+		requestLog(r).WithField("client", c.Name).Info("Authenticated request")
+		h(w, r)
+	}
+}
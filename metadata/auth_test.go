@@ -0,0 +1,64 @@
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testCredentials = []Credential{
+	{Name: "dashboard", APIKey: "read-key", Role: RoleRead},
+	{Name: "ops", Username: "ops", Password: "secret", Role: RolePublish},
+}
+
+func TestRequireRole(t *testing.T) {
+	auth, err := NewAuthenticator(testCredentials)
+	assert.NoError(t, err, "Failed to create authenticator")
+
+	tests := []struct {
+		role     string
+		apiKey   string
+		username string
+		password string
+		expected int
+	}{
+		{RoleRead, "", "", "", http.StatusUnauthorized},
+		{RoleRead, "wrong-key", "", "", http.StatusUnauthorized},
+		{RoleRead, "read-key", "", "", http.StatusOK},
+		{RolePublish, "read-key", "", "", http.StatusForbidden},
+		{RolePublish, "", "ops", "wrong", http.StatusUnauthorized},
+		{RolePublish, "", "ops", "secret", http.StatusOK},
+		{RoleRead, "", "ops", "secret", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		h := auth.Require(test.role, func(w http.ResponseWriter, r *http.Request) {})
+		req := httptest.NewRequest("GET", "/backfill/status", nil)
+		if test.apiKey != "" {
+			req.Header.Set(apiKeyHeader, test.apiKey)
+		}
+		if test.username != "" {
+			req.SetBasicAuth(test.username, test.password)
+		}
+
+		w := httptest.NewRecorder()
+		h(w, req)
+		assert.Equal(t, test.expected, w.Code, "Unexpected status code for %+v", test)
+	}
+}
+
+func TestRequireWithoutAuthenticator(t *testing.T) {
+	var auth *Authenticator
+	h := auth.Require(RolePublish, func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("POST", "/metadata/publish", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "Requests should not be authenticated without credentials")
+}
+
+func TestNewAuthenticatorInvalidRole(t *testing.T) {
+	_, err := NewAuthenticator([]Credential{{Name: "foo", APIKey: "bar", Role: "admin"}})
+	assert.Error(t, err, "Expecting error for an unknown role")
+}
@@ -0,0 +1,392 @@
+package metadata
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	BackfillRunning   = "running"
+	BackfillPaused    = "paused"
+	BackfillCancelled = "cancelled"
+	BackfillFinished  = "finished"
+	BackfillFailed    = "failed"
+)
+
+var (
+	ErrBackfillInProgress = errors.New("A backfill is already in progress")
+	ErrNoBackfill         = errors.New("There is no backfill in progress")
+)
+
+// DefaultMaxCountDeviation is the MaxCountDeviation of backfills not giving one
+const DefaultMaxCountDeviation = 10
+
+type PublishOptions struct {
+	Source    string `json:"source"`
+	BatchSize int    `json:"batchSize"`
+	Skip      int    `json:"skip"`
+	Total     int    `json:"total"`
+	// PreCount counts the matching content before starting, to be used as Total
+	PreCount bool `json:"preCount"`
+	// ExpectedCount makes a pre-counted backfill refuse to start if the count differs by more than MaxCountDeviation percent
+	ExpectedCount     int `json:"expectedCount"`
+	MaxCountDeviation int `json:"maxCountDeviation"`
+}
+
+type CountMismatchError struct {
+	Source   string
+	Count    int
+	Expected int
+}
+
+func (e *CountMismatchError) Error() string {
+	return fmt.Sprintf("Found %d content items for source %s but expected %d", e.Count, e.Source, e.Expected)
+}
+
+func checkCount(options PublishOptions, count int) error {
+	if options.ExpectedCount <= 0 {
+		return nil
+	}
+	deviation := math.Abs(float64(count-options.ExpectedCount)) / float64(options.ExpectedCount) * 100
+	if deviation > float64(options.MaxCountDeviation) {
+		return &CountMismatchError{Source: options.Source, Count: count, Expected: options.ExpectedCount}
+	}
+	return nil
+}
+
+type BackfillStatus struct {
+	ID         string         `json:"id"`
+	Options    PublishOptions `json:"options"`
+	State      string         `json:"state"`
+	Position   int            `json:"position"`
+	Published  int64          `json:"published"`
+	NoMetadata int64          `json:"noMetadata"`
+	Failed     int64          `json:"failed"`
+	// FailedBy counts the failures by kind, e.g. not_found or throttled
+	FailedBy   map[string]int64 `json:"failedBy,omitempty"`
+	StartedAt  time.Time        `json:"startedAt"`
+	FinishedAt *time.Time       `json:"finishedAt,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Rate       float64          `json:"ratePerSecond"`
+	Percent    float64          `json:"percent,omitempty"`
+	ETA        string           `json:"eta,omitempty"`
+}
+
+type jobStats struct {
+	runID      string
+	published  int64
+	noMetadata int64
+	failed     int64
+
+	failedByMu sync.Mutex
+	failedBy   map[string]int64
+}
+
+func (s *jobStats) fail(kind string) {
+	s.failedByMu.Lock()
+	defer s.failedByMu.Unlock()
+	if s.failedBy == nil {
+		s.failedBy = map[string]int64{}
+	}
+	s.failedBy[kind]++
+	atomic.AddInt64(&s.failed, 1)
+}
+
+func (s *jobStats) failuresByKind() map[string]int64 {
+	s.failedByMu.Lock()
+	defer s.failedByMu.Unlock()
+	if len(s.failedBy) == 0 {
+		return nil
+	}
+	failedBy := make(map[string]int64, len(s.failedBy))
+	for kind, count := range s.failedBy {
+		failedBy[kind] = count
+	}
+	return failedBy
+}
+
+func (s *jobStats) processed() int64 {
+	return atomic.LoadInt64(&s.published) + atomic.LoadInt64(&s.noMetadata) + atomic.LoadInt64(&s.failed)
+}
+
+type Backfill struct {
+	jobStats
+	ID      string
+	options PublishOptions
+
+	mu         sync.Mutex
+	state      string
+	position   int
+	startedAt  time.Time
+	finishedAt time.Time
+	pausedAt   time.Time
+	pausedFor  time.Duration
+	err        error
+	resumed    chan struct{}
+	cancelled  chan struct{}
+}
+
+func NewBackfill(options PublishOptions) *Backfill {
+	id := newRunID()
+	return &Backfill{
+		jobStats:  jobStats{runID: id},
+		ID:        id,
+		options:   options,
+		state:     BackfillRunning,
+		startedAt: time.Now(),
+		cancelled: make(chan struct{}),
+	}
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (b *Backfill) Pause() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BackfillRunning {
+		return fmt.Errorf("Cannot pause backfill in state %s", b.state)
+	}
+	b.state = BackfillPaused
+	b.pausedAt = time.Now()
+	b.resumed = make(chan struct{})
+	return nil
+}
+
+func (b *Backfill) Resume() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BackfillPaused {
+		return fmt.Errorf("Cannot resume backfill in state %s", b.state)
+	}
+	b.state = BackfillRunning
+	b.pausedFor += time.Since(b.pausedAt)
+	close(b.resumed)
+	return nil
+}
+
+func (b *Backfill) Cancel() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BackfillRunning && b.state != BackfillPaused {
+		return fmt.Errorf("Cannot cancel backfill in state %s", b.state)
+	}
+	if b.state == BackfillPaused {
+		b.pausedFor += time.Since(b.pausedAt)
+	}
+	b.state = BackfillCancelled
+	close(b.cancelled)
+	return nil
+}
+
+func (b *Backfill) isCancelled() bool {
+	select {
+	case <-b.cancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitWhilePaused blocks while the backfill is paused and returns false if it got cancelled
+func (b *Backfill) waitWhilePaused() bool {
+	b.mu.Lock()
+	resumed := b.resumed
+	paused := b.state == BackfillPaused
+	b.mu.Unlock()
+
+	if paused {
+		select {
+		case <-resumed:
+		case <-b.cancelled:
+		}
+	}
+	return !b.isCancelled()
+}
+
+// sleep waits for the given duration and returns false if the backfill got cancelled in the meantime
+func (b *Backfill) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-b.cancelled:
+		return false
+	}
+}
+
+func (b *Backfill) setPosition(position int) {
+	b.mu.Lock()
+	b.position = position
+	b.mu.Unlock()
+}
+
+func (b *Backfill) finish(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.state = BackfillFailed
+		b.err = err
+	} else if b.state != BackfillCancelled {
+		b.state = BackfillFinished
+	}
+	b.finishedAt = time.Now()
+}
+
+func (b *Backfill) Status() BackfillStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BackfillStatus{
+		ID:         b.ID,
+		Options:    b.options,
+		State:      b.state,
+		Position:   b.position,
+		Published:  atomic.LoadInt64(&b.published),
+		NoMetadata: atomic.LoadInt64(&b.noMetadata),
+		Failed:     atomic.LoadInt64(&b.failed),
+		FailedBy:   b.failuresByKind(),
+		StartedAt:  b.startedAt,
+	}
+	if b.err != nil {
+		status.Error = b.err.Error()
+	}
+
+	end := time.Now()
+	if !b.finishedAt.IsZero() {
+		end = b.finishedAt
+		status.FinishedAt = &b.finishedAt
+	}
+	active := end.Sub(b.startedAt) - b.pausedFor
+	if b.state == BackfillPaused {
+		active -= end.Sub(b.pausedAt)
+	}
+	if active > 0 {
+		status.Rate = float64(b.processed()) / active.Seconds()
+	}
+
+	if b.options.Total > 0 {
+		status.Percent = math.Min(100, float64(b.position)/float64(b.options.Total)*100)
+	}
+	remaining := b.options.Total - b.position
+	if status.Rate > 0 && remaining > 0 && b.finishedAt.IsZero() {
+		status.ETA = (time.Duration(float64(remaining)/status.Rate) * time.Second).String()
+	}
+	return status
+}
+
+type BackfillManager struct {
+	mp      *V1MetadataPublishService
+	mu      sync.Mutex
+	current *Backfill
+	// counting reserves the slot of the current backfill while the one being started counts its content
+	counting bool
+	// previousBatchSize is the batch size to restore once the current backfill with its own batch size finishes
+	previousBatchSize int
+}
+
+func NewBackfillManager(mp *V1MetadataPublishService) *BackfillManager {
+	return &BackfillManager{mp: mp}
+}
+
+// Start runs a backfill in the background, unless the previous one has not finished yet
+func (m *BackfillManager) Start(options PublishOptions) (*Backfill, error) {
+	if options.Source == "" {
+		options.Source = m.mp.source
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counting || (m.current != nil && m.current.Status().FinishedAt == nil) {
+		return nil, ErrBackfillInProgress
+	}
+	if options.PreCount {
+		//count without holding the lock, which status requests need, refusing other starts meanwhile
+		m.counting = true
+		m.mu.Unlock()
+		total, err := m.countContent(options)
+		m.mu.Lock()
+		m.counting = false
+		if err != nil {
+			return nil, err
+		}
+		options.Total = total
+	}
+
+	//the previous backfill may have finished without its batch size being restored yet
+	m.restoreBatchSize()
+	limits := m.mp.RateLimits()
+	if options.BatchSize <= 0 {
+		options.BatchSize = limits.BatchSize
+	}
+	if options.BatchSize != limits.BatchSize {
+		previous := limits.BatchSize
+		limits.BatchSize = options.BatchSize
+		err := m.mp.SetRateLimits(limits)
+		if err != nil {
+			return nil, err
+		}
+		m.previousBatchSize = previous
+	}
+
+	b := NewBackfill(options)
+	m.current = b
+	go func() {
+		err := m.mp.PublishBackfill(b)
+		if err != nil {
+			log.WithFields(logrus.Fields{runIDField: b.ID, stageField: stageBackfill}).WithError(err).Error("Backfill failed")
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.current == b {
+			m.restoreBatchSize()
+		}
+	}()
+	log.WithFields(logrus.Fields{runIDField: b.ID, sourceField: options.Source, stageField: stageBackfill}).Info("Started backfill")
+	return b, nil
+}
+
+func (m *BackfillManager) countContent(options PublishOptions) (int, error) {
+	count, err := m.mp.cs.CountContent(options.Source)
+	if err != nil {
+		return 0, err
+	}
+	log.WithFields(logrus.Fields{sourceField: options.Source, stageField: stageScan, "count": count}).Info("Counted matching content")
+	return count, checkCount(options, count)
+}
+
+// restoreBatchSize gives back the service its batch size after a backfill that had its own, unless the rate limits
+// were changed in the meantime; m.mu must be held
+func (m *BackfillManager) restoreBatchSize() {
+	if m.previousBatchSize == 0 {
+		return
+	}
+	limits := m.mp.RateLimits()
+	if m.current != nil && limits.BatchSize == m.current.options.BatchSize {
+		limits.BatchSize = m.previousBatchSize
+		err := m.mp.SetRateLimits(limits)
+		if err != nil {
+			log.WithField(stageField, stageBackfill).WithError(err).Error("Restoring batch size failed")
+		}
+	}
+	m.previousBatchSize = 0
+}
+
+func (m *BackfillManager) Current() (*Backfill, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current == nil {
+		return nil, ErrNoBackfill
+	}
+	return m.current, nil
+}
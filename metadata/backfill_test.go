@@ -0,0 +1,135 @@
+package metadata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfillPauseAndResume(t *testing.T) {
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 10})
+
+	err := b.Pause()
+	assert.NoError(t, err, "Failed to pause backfill")
+	assert.Equal(t, BackfillPaused, b.Status().State, "Backfill should be paused")
+	assert.Error(t, b.Pause(), "Expecting error when pausing a paused backfill")
+
+	resumed := make(chan bool)
+	go func() {
+		resumed <- b.waitWhilePaused()
+	}()
+
+	err = b.Resume()
+	assert.NoError(t, err, "Failed to resume backfill")
+	assert.True(t, <-resumed, "Backfill should continue after being resumed")
+	assert.Equal(t, BackfillRunning, b.Status().State, "Backfill should be running")
+	assert.Error(t, b.Resume(), "Expecting error when resuming a running backfill")
+}
+
+func TestBackfillCancelWhilePaused(t *testing.T) {
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 10})
+	assert.NoError(t, b.Pause(), "Failed to pause backfill")
+
+	resumed := make(chan bool)
+	go func() {
+		resumed <- b.waitWhilePaused()
+	}()
+
+	err := b.Cancel()
+	assert.NoError(t, err, "Failed to cancel backfill")
+	assert.False(t, <-resumed, "Backfill should not continue after being cancelled")
+	assert.Equal(t, BackfillCancelled, b.Status().State, "Backfill should be cancelled")
+	assert.Error(t, b.Cancel(), "Expecting error when cancelling a cancelled backfill")
+	assert.False(t, b.sleep(time.Minute), "Sleeping should be interrupted by cancellation")
+
+	b.finish(nil)
+	assert.Equal(t, BackfillCancelled, b.Status().State, "Finishing should keep the cancelled state")
+	assert.NotNil(t, b.Status().FinishedAt, "Finished time should be set")
+}
+
+func TestBackfillStatusETA(t *testing.T) {
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 10, Total: 300})
+	b.startedAt = time.Now().Add(-10 * time.Second)
+	b.published = 100
+	b.setPosition(100)
+
+	status := b.Status()
+	assert.InDelta(t, 10, status.Rate, 0.1, "Unexpected publish rate")
+	assert.NotEmpty(t, status.ETA, "ETA should be set when the total is known")
+
+	b.finish(nil)
+	assert.Empty(t, b.Status().ETA, "ETA should not be set for a finished backfill")
+}
+
+func TestBackfillStatusPercent(t *testing.T) {
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 10, Total: 200})
+	b.setPosition(50)
+
+	assert.Equal(t, 25.0, b.Status().Percent, "Unexpected percentage")
+}
+
+func TestCheckCount(t *testing.T) {
+	options := PublishOptions{Source: "BLOGS", ExpectedCount: 1000, MaxCountDeviation: 10}
+
+	assert.NoError(t, checkCount(options, 1050), "Count within the deviation should be accepted")
+	assert.NoError(t, checkCount(options, 900), "Count within the deviation should be accepted")
+	err := checkCount(options, 1200)
+	assert.IsType(t, &CountMismatchError{}, err, "Count outside the deviation should be refused")
+	assert.NoError(t, checkCount(PublishOptions{Source: "BLOGS"}, 1200), "Count should not be checked without an expected count")
+}
+
+func TestStartRefusesUnexpectedCount(t *testing.T) {
+	mp := &V1MetadataPublishService{
+		cs: &MockContentService{
+			mockCountContent: func(source string) (int, error) {
+				assert.Equal(t, "BLOGS", source, "Unexpected source counted")
+				return 10, nil
+			},
+		},
+		limits: newRateLimiter(RateLimits{BatchSize: 10}),
+	}
+	bm := NewBackfillManager(mp)
+
+	_, err := bm.Start(PublishOptions{Source: "BLOGS", PreCount: true, ExpectedCount: 1000, MaxCountDeviation: 10})
+	assert.IsType(t, &CountMismatchError{}, err, "Backfill should not start with an unexpected count")
+	_, err = bm.Current()
+	assert.Equal(t, ErrNoBackfill, err, "No backfill should have been started")
+}
+
+func TestStartChecksProgressBeforeCounting(t *testing.T) {
+	counting := make(chan bool)
+	release := make(chan bool)
+	mp := &V1MetadataPublishService{
+		cs: &MockContentService{
+			mockCountContent: func(source string) (int, error) {
+				counting <- true
+				<-release
+				return 10, nil
+			},
+		},
+		limits: newRateLimiter(RateLimits{BatchSize: 10}),
+	}
+	bm := NewBackfillManager(mp)
+
+	done := make(chan error)
+	go func() {
+		_, err := bm.Start(PublishOptions{Source: "BLOGS", PreCount: true, ExpectedCount: 1000})
+		done <- err
+	}()
+	<-counting
+	_, err := bm.Start(PublishOptions{Source: "BLOGS", PreCount: true})
+	assert.Equal(t, ErrBackfillInProgress, err, "Another backfill should not start while one is counting")
+	close(release)
+	assert.IsType(t, &CountMismatchError{}, <-done, "Backfill should not start with an unexpected count")
+
+	bm.current = NewBackfill(PublishOptions{Source: "BLOGS"})
+	mp.cs = &MockContentService{
+		mockCountContent: func(source string) (int, error) {
+			assert.Fail(t, "Content should not be counted while a backfill is in progress")
+			return 0, nil
+		},
+	}
+	_, err = bm.Start(PublishOptions{Source: "BLOGS", PreCount: true})
+	assert.Equal(t, ErrBackfillInProgress, err, "Another backfill should not start while one is running")
+}
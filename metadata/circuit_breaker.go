@@ -0,0 +1,113 @@
+package metadata
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// circuitBreaker stops the reads once the binding service failed a number of times in a row. After a cooldown
+// a single read is let through as a probe, closing the circuit again if it succeeds and reopening it otherwise
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	// changed is closed and replaced whenever the state changes, waking up the waiting reads
+	changed chan struct{}
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, state: CircuitClosed, changed: make(chan struct{})}
+}
+
+// wait blocks while the circuit is open and returns false if cancelled in the meantime; a nil circuit breaker never blocks
+func (cb *circuitBreaker) wait(cancelled <-chan struct{}) bool {
+	if cb == nil {
+		return true
+	}
+	for {
+		cb.mu.Lock()
+		state := cb.state
+		changed := cb.changed
+		var timeout <-chan time.Time
+		if state == CircuitOpen {
+			remaining := cb.cooldown - time.Since(cb.openedAt)
+			if remaining <= 0 {
+				//this read is the probe
+				cb.setState(CircuitHalfOpen)
+				cb.mu.Unlock()
+				return true
+			}
+			timeout = time.After(remaining)
+		}
+		cb.mu.Unlock()
+
+		if state == CircuitClosed {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+		case <-cancelled:
+			return false
+		}
+	}
+}
+
+// record counts the outcome of a read, only failures meaning that the binding service is not working counting as failures
+func (cb *circuitBreaker) record(err error) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if err == nil || !isUnavailable(err) {
+		cb.failures = 0
+		if cb.state != CircuitClosed {
+			cb.setState(CircuitClosed)
+		}
+		return
+	}
+	cb.failures++
+	if cb.state == CircuitHalfOpen || (cb.state == CircuitClosed && cb.failures >= cb.threshold) {
+		cb.openedAt = time.Now()
+		cb.setState(CircuitOpen)
+	}
+}
+
+func (cb *circuitBreaker) currentState() string {
+	if cb == nil {
+		return CircuitClosed
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+func (cb *circuitBreaker) setState(state string) {
+	logger := log.WithFields(logrus.Fields{stageField: stageRead, "circuit": state, "failures": cb.failures})
+	switch state {
+	case CircuitOpen:
+		logger.Errorf("Binding service is failing, pausing reads for %s", cb.cooldown)
+		circuitOpen.Set(1)
+	case CircuitHalfOpen:
+		logger.Info("Probing binding service")
+	case CircuitClosed:
+		logger.Info("Binding service recovered, resuming reads")
+		circuitOpen.Set(0)
+	}
+	cb.state = state
+	close(cb.changed)
+	cb.changed = make(chan struct{})
+}
@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errUnavailable = statusError(stageRead, http.StatusServiceUnavailable, "binding service")
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	cb := newCircuitBreaker(3, time.Hour)
+
+	cb.record(errUnavailable)
+	cb.record(errUnavailable)
+	cb.record(errors.New("Received response with status code 404 from binding service"))
+	cb.record(errUnavailable)
+	cb.record(errUnavailable)
+	assert.Equal(t, CircuitClosed, cb.currentState(), "Failures about the content itself should reset the count")
+
+	cb.record(errUnavailable)
+	assert.Equal(t, CircuitOpen, cb.currentState(), "Circuit should open after 3 consecutive failures")
+
+	cancelled := make(chan struct{})
+	waited := make(chan bool)
+	go func() {
+		waited <- cb.wait(cancelled)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("Reads should wait while the circuit is open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(cancelled)
+	assert.False(t, <-waited, "Cancelled wait should return false")
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	cb := newCircuitBreaker(1, 20*time.Millisecond)
+	cb.record(errUnavailable)
+	assert.Equal(t, CircuitOpen, cb.currentState(), "Circuit should be open")
+
+	assert.True(t, cb.wait(nil), "Probe should be let through after the cooldown")
+	assert.Equal(t, CircuitHalfOpen, cb.currentState(), "Circuit should be half-open while probing")
+
+	waited := make(chan bool)
+	go func() {
+		waited <- cb.wait(nil)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("Only the probe should be let through")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cb.record(errUnavailable)
+	assert.Equal(t, CircuitOpen, cb.currentState(), "Failed probe should reopen the circuit")
+
+	//the waiting read becomes the next probe
+	assert.True(t, <-waited, "Next probe should be let through after the cooldown")
+	cb.record(nil)
+	assert.Equal(t, CircuitClosed, cb.currentState(), "Successful probe should close the circuit")
+	assert.True(t, cb.wait(nil), "Reads should go through a closed circuit")
+}
+
+func TestPublishPausesWhileBindingServiceDown(t *testing.T) {
+	h := newHarness(t, testContents(10, methodeAuthority, 0), RateLimits{BatchSize: 20, MaxConcurrency: 1})
+	defer h.Close()
+	h.mp.SetCircuitBreaker(2, 100*time.Millisecond)
+	h.bindingService.setDown(true)
+	time.AfterFunc(400*time.Millisecond, func() {
+		h.bindingService.setDown(false)
+	})
+
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 20})
+	err := h.mp.PublishBackfill(b)
+	assert.NoError(t, err, "Backfill should finish without error")
+
+	status := b.Status()
+	assert.True(t, status.Failed < 6, "Reads should pause instead of failing, %d failed", status.Failed)
+	assert.Equal(t, int64(10), status.Published+status.Failed, "Every content item should be accounted for")
+	assert.Equal(t, CircuitClosed, h.mp.breaker.currentState(), "Circuit should be closed again")
+}
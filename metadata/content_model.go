@@ -1,12 +1,21 @@
 package metadata
 
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+var uuidRegexp = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
 type Content struct {
 	UUID        string       `json:"uuid"`
 	Identifiers []Identifier `json:"identifiers"`
 }
 
 type Identifier struct {
-	Authority string `json:"authority"`
+	Authority       string `json:"authority"`
+	IdentifierValue string `json:"identifierValue,omitempty" bson:"identifierValue"`
 }
 
 var sourceMap = map[string]string{
@@ -35,7 +44,49 @@ var sourceMap = map[string]string{
 	"http://api.ft.com/system/FT-LABS-WP-1-292": "BLOGS",
 }
 
+func authoritiesOf(source string) []string {
+	authorities := []string{}
+	for authority, s := range sourceMap {
+		if s == source {
+			authorities = append(authorities, authority)
+		}
+	}
+	sort.Strings(authorities)
+	return authorities
+}
+
+func isKnownSource(source string) bool {
+	for _, s := range sourceMap {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that the content can be published: a valid UUID and identifiers with known authorities of a single source
+func (c Content) validate() error {
+	if !uuidRegexp.MatchString(c.UUID) {
+		return fmt.Errorf("Invalid UUID %q", c.UUID)
+	}
+	if len(c.Identifiers) == 0 {
+		return fmt.Errorf("No identifiers for content %s", c.UUID)
+	}
+	for _, id := range c.Identifiers {
+		if _, ok := sourceMap[id.Authority]; !ok {
+			return fmt.Errorf("Unknown authority %q for content %s", id.Authority, c.UUID)
+		}
+	}
+	if _, ok := c.getSource(); !ok {
+		return fmt.Errorf("Identifiers of content %s belong to different sources", c.UUID)
+	}
+	return nil
+}
+
 func (c Content) getSource() (string, bool) {
+	if len(c.Identifiers) == 0 {
+		return "", false
+	}
 	source := sourceMap[c.Identifiers[0].Authority]
 	if len(c.Identifiers) == 1 {
 		return source, true
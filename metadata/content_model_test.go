@@ -55,3 +55,41 @@ func TestGetSourceSuccessfullyForMultipleDifferentSourcesContent(t *testing.T) {
 	_, ok := testContent.getSource()
 	assert.False(t, ok, "Expecting error but no error was found")
 }
+
+func TestGetSourceForContentWithoutIdentifiers(t *testing.T) {
+	testContent := Content{UUID: "9cc74217-7690-35be-a0d6-683d118561d4"}
+
+	_, ok := testContent.getSource()
+	assert.False(t, ok, "Expecting content without identifiers to have no source")
+}
+
+func TestValidateContent(t *testing.T) {
+	tests := []struct {
+		content Content
+		valid   bool
+	}{
+		{testContent, true},
+		{Content{UUID: "not-a-uuid", Identifiers: testContent.Identifiers}, false},
+		{Content{UUID: testContent.UUID}, false},
+		{Content{UUID: testContent.UUID, Identifiers: []Identifier{{Authority: "http://api.ft.com/system/UNKNOWN"}}}, false},
+		{Content{UUID: testContent.UUID, Identifiers: []Identifier{
+			{Authority: "http://api.ft.com/system/FT-LABS-WP-1-335"},
+			{Authority: "http://api.ft.com/system/FTCOM-METHODE"},
+		}}, false},
+	}
+
+	for _, test := range tests {
+		err := test.content.validate()
+		if test.valid {
+			assert.NoError(t, err, "Expecting content %v to be valid", test.content)
+		} else {
+			assert.Error(t, err, "Expecting content %v to be invalid", test.content)
+		}
+	}
+}
+
+func TestAuthoritiesOf(t *testing.T) {
+	assert.Equal(t, []string{"http://api.ft.com/system/FTCOM-METHODE"}, authoritiesOf("METHODE"), "Unexpected METHODE authorities")
+	assert.Len(t, authoritiesOf("BLOGS"), 22, "Unexpected number of BLOGS authorities")
+	assert.Empty(t, authoritiesOf("UNKNOWN"), "Unknown source should have no authorities")
+}
@@ -1,23 +1,42 @@
 package metadata
 
 import (
+	"errors"
 	"net"
 	"strings"
 	"time"
 
 	"fmt"
 
+	"github.com/sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 type ContentService interface {
-	GetContent(source string) chan Content
+	// GetContent streams the content of the source until stopped; a failure of the scan is sent to the buffered errCh before the stream is closed
+	GetContent(source string, stop <-chan struct{}, errCh chan error) chan Content
+	GetContentByUUIDs(uuids []string) ([]Content, error)
+	CountContent(source string) (int, error)
 }
 
+const (
+	uuidLookupChunkSize = 1000
+
+	defaultDBName     = "upp-store"
+	defaultCollection = "content"
+)
+
+var contentProjection = bson.M{"uuid": true, "_id": false, "identifiers.authority": true, "identifiers.identifierValue": true}
+
 type UPPContentService struct {
-	dbName  string
-	session *mgo.Session
+	dbName     string
+	collection string
+	// baseQuery selects the content to be published from the collection, before filtering by source
+	baseQuery bson.M
+	// indexHint are the key fields of the index the scan of the content should use, if set
+	indexHint []string
+	session   *mgo.Session
 }
 
 func tcpDialServer(addr *mgo.ServerAddr) (net.Conn, error) {
@@ -47,28 +66,141 @@ func InitContentService(delivery *Cluster) (*UPPContentService, error) {
 	}
 	session.SetMode(mgo.Strong, true)
 	session.SetCursorTimeout(0)
-	return &UPPContentService{session: session}, nil
+	return &UPPContentService{
+		dbName:     defaultDBName,
+		collection: defaultCollection,
+		baseQuery:  bson.M{"mediaType": nil},
+		session:    session,
+	}, nil
+}
+
+// SetStore selects the database and collection the content is read from, and optionally replaces the base query
+// with the given JSON query, in MongoDB extended JSON for e.g. dates: {"firstPublishedDate": {"$gte": {"$date": "2017-01-01T00:00:00Z"}}}
+func (c *UPPContentService) SetStore(dbName string, collection string, query string) error {
+	if dbName == "" || collection == "" {
+		return errors.New("Database and collection names cannot be empty")
+	}
+	if query != "" {
+		var baseQuery bson.M
+		err := bson.UnmarshalJSON([]byte(query), &baseQuery)
+		if err != nil {
+			return fmt.Errorf("Invalid content query %s: %s", query, err)
+		}
+		c.baseQuery = baseQuery
+	}
+	c.dbName = dbName
+	c.collection = collection
+	return nil
 }
 
-func (c *UPPContentService) GetContent(source string) chan Content {
+// SetIndexHint makes the scan of the content use the index with the given comma separated key fields,
+// e.g. identifiers.authority, instead of the index chosen by Mongo
+func (c *UPPContentService) SetIndexHint(hint string) error {
+	keys := []string{}
+	for _, key := range strings.Split(hint, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" || key == "-" {
+			return fmt.Errorf("Invalid index hint %q", hint)
+		}
+		keys = append(keys, key)
+	}
+	c.indexHint = keys
+	return nil
+}
+
+// sourceConditions matches the content whose identifiers all have authorities of the source, as getSource does
+func sourceConditions(source string) bson.M {
+	authorities := authoritiesOf(source)
+	return bson.M{
+		"identifiers.authority": bson.M{"$in": authorities},
+		"identifiers":           bson.M{"$not": bson.M{"$elemMatch": bson.M{"authority": bson.M{"$nin": authorities}}}},
+	}
+}
+
+// query combines the base query with the given conditions
+func (c *UPPContentService) query(conditions bson.M) bson.M {
+	if len(c.baseQuery) == 0 {
+		return conditions
+	}
+	if len(conditions) == 0 {
+		return c.baseQuery
+	}
+	return bson.M{"$and": []bson.M{c.baseQuery, conditions}}
+}
+
+func (c *UPPContentService) GetContent(source string, stop <-chan struct{}, errCh chan error) chan Content {
 	result := make(chan Content)
 
 	go func() {
 		defer close(result)
-		coll := c.session.DB("upp-store").C("content")
-		iter := coll.Find(bson.M{"mediaType": nil}).Select(bson.M{"uuid": true, "_id": false, "identifiers.authority": true}).Iter()
+		coll := c.session.DB(c.dbName).C(c.collection)
+		query := coll.Find(c.query(sourceConditions(source))).Select(contentProjection)
+		if len(c.indexHint) > 0 {
+			query = query.Hint(c.indexHint...)
+		}
+		iter := query.Iter()
 
 		var content Content
 		var count int
 		for iter.Next(&content) {
+			mongoDocumentsScanned.Inc()
+			//the query only selects content of the source, this guards against a base query doing otherwise with $or
 			cSource, ok := content.getSource()
 			if ok && source == cSource {
+				mongoDocumentsMatched.Inc()
 				count++
-				result <- content
+				select {
+				case result <- content:
+				case <-stop:
+					log.WithFields(logrus.Fields{sourceField: source, stageField: stageScan, "count": count}).Info("Stopped reading content")
+					iter.Close()
+					return
+				}
 			}
 		}
-		fmt.Printf("Read %d content items\n", count)
+		if err := iter.Close(); err != nil {
+			log.WithFields(logrus.Fields{sourceField: source, stageField: stageScan, "count": count}).WithError(err).Error("Reading content failed")
+			errCh <- fmt.Errorf("Reading content failed: %s", err)
+			return
+		}
+		log.WithFields(logrus.Fields{sourceField: source, stageField: stageScan, "count": count}).Info("Finished reading content")
 	}()
 
 	return result
 }
+
+// GetContentByUUIDs looks up the identifiers of the given content, omitting UUIDs that are not in the store;
+// the base query does not apply, as the content is asked for explicitly
+func (c *UPPContentService) GetContentByUUIDs(uuids []string) ([]Content, error) {
+	session := c.session.Copy()
+	defer session.Close()
+	coll := session.DB(c.dbName).C(c.collection)
+
+	result := []Content{}
+	for start := 0; start < len(uuids); start += uuidLookupChunkSize {
+		end := start + uuidLookupChunkSize
+		if end > len(uuids) {
+			end = len(uuids)
+		}
+		var contents []Content
+		err := coll.Find(bson.M{"uuid": bson.M{"$in": uuids[start:end]}}).Select(contentProjection).All(&contents)
+		if err != nil {
+			return nil, fmt.Errorf("Looking up content failed: %s", err)
+		}
+		result = append(result, contents...)
+	}
+	return result, nil
+}
+
+// CountContent counts the content that GetContent would return for the source,
+// i.e. content whose identifiers all have authorities of that source
+func (c *UPPContentService) CountContent(source string) (int, error) {
+	session := c.session.Copy()
+	defer session.Close()
+
+	count, err := session.DB(c.dbName).C(c.collection).Find(c.query(sourceConditions(source))).Count()
+	if err != nil {
+		return 0, fmt.Errorf("Counting content failed: %s", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,58 @@
+package metadata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSetStore(t *testing.T) {
+	c := &UPPContentService{dbName: defaultDBName, collection: defaultCollection, baseQuery: bson.M{"mediaType": nil}}
+
+	assert.NoError(t, c.SetStore("store", "articles", ""), "Failed to set store")
+	assert.Equal(t, "store", c.dbName, "Unexpected database")
+	assert.Equal(t, "articles", c.collection, "Unexpected collection")
+	assert.Equal(t, bson.M{"mediaType": nil}, c.baseQuery, "Base query should be kept without a query")
+
+	err := c.SetStore("store", "articles", `{"type": "Article", "firstPublishedDate": {"$gte": {"$date": "2017-01-01T00:00:00Z"}}}`)
+	assert.NoError(t, err, "Failed to set store")
+	assert.Equal(t, "Article", c.baseQuery["type"], "Unexpected base query")
+	assert.Equal(t, time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), c.baseQuery["firstPublishedDate"].(map[string]interface{})["$gte"].(time.Time).UTC(), "Dates should be parsed")
+
+	assert.Error(t, c.SetStore("store", "articles", `{"type": `), "Expecting error for invalid query")
+	assert.Error(t, c.SetStore("", "articles", ""), "Expecting error for empty database")
+}
+
+func TestContentQuery(t *testing.T) {
+	conditions := bson.M{"identifiers.authority": bson.M{"$in": []string{"http://api.ft.com/system/FTCOM-METHODE"}}}
+
+	c := &UPPContentService{baseQuery: bson.M{"mediaType": nil}}
+	assert.Equal(t, bson.M{"mediaType": nil}, c.query(nil), "Base query expected without conditions")
+	assert.Equal(t, bson.M{"$and": []bson.M{{"mediaType": nil}, conditions}}, c.query(conditions), "Conditions should be added to the base query")
+
+	c = &UPPContentService{baseQuery: bson.M{}}
+	assert.Equal(t, conditions, c.query(conditions), "Conditions expected with an empty base query")
+}
+
+func TestSourceConditions(t *testing.T) {
+	conditions := sourceConditions("METHODE")
+	assert.Equal(t, bson.M{
+		"identifiers.authority": bson.M{"$in": []string{"http://api.ft.com/system/FTCOM-METHODE"}},
+		"identifiers":           bson.M{"$not": bson.M{"$elemMatch": bson.M{"authority": bson.M{"$nin": []string{"http://api.ft.com/system/FTCOM-METHODE"}}}}},
+	}, conditions, "Unexpected conditions for METHODE")
+
+	blogs := sourceConditions("BLOGS")["identifiers.authority"].(bson.M)["$in"].([]string)
+	assert.Len(t, blogs, 22, "All blog authorities should be selected")
+	assert.Contains(t, blogs, "http://api.ft.com/system/FT-CLAMO", "Unexpected blog authorities")
+}
+
+func TestSetIndexHint(t *testing.T) {
+	c := &UPPContentService{}
+	assert.NoError(t, c.SetIndexHint("identifiers.authority"), "Failed to set index hint")
+	assert.Equal(t, []string{"identifiers.authority"}, c.indexHint, "Unexpected index hint")
+	assert.NoError(t, c.SetIndexHint("identifiers.authority, -uuid"), "Failed to set index hint")
+	assert.Equal(t, []string{"identifiers.authority", "-uuid"}, c.indexHint, "Unexpected index hint")
+	assert.Error(t, c.SetIndexHint("identifiers.authority,,uuid"), "Expecting error for empty key")
+}
@@ -0,0 +1,165 @@
+package metadata
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishFullRun(t *testing.T) {
+	methode := testContents(12, methodeAuthority, 0)
+	blogs := testContents(3, "http://api.ft.com/system/FT-CLAMO", 100)
+	h := newHarness(t, append(methode, blogs...), RateLimits{BatchSize: 5})
+	defer h.Close()
+	h.bindingService.noMetadata[methode[1].UUID] = true
+	h.bindingService.noMetadata[methode[7].UUID] = true
+	h.bindingService.failures[methode[3].UUID] = http.StatusInternalServerError
+	h.notifier.failures[methode[10].UUID] = http.StatusServiceUnavailable
+
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 5})
+	err := h.mp.PublishBackfill(b)
+	assert.NoError(t, err, "Backfill should finish without error")
+
+	status := b.Status()
+	assert.Equal(t, BackfillFinished, status.State, "Backfill should be finished")
+	assert.Equal(t, 12, status.Position, "All the content of the source should be scanned")
+	assert.Equal(t, int64(8), status.Published, "Unexpected number of published contents")
+	assert.Equal(t, int64(2), status.NoMetadata, "Unexpected number of contents without metadata")
+	assert.Equal(t, int64(2), status.Failed, "Unexpected number of failed contents")
+
+	assert.Equal(t, uuidsOf(methode), h.bindingService.requested(), "Metadata should be read only for the content of the source")
+	expected := []Content{}
+	for i, c := range methode {
+		if i != 1 && i != 3 && i != 7 {
+			expected = append(expected, c)
+		}
+	}
+	assert.Equal(t, uuidsOf(expected), h.notifier.receivedUUIDs(), "Only content with metadata should be published")
+
+	metadata, err := getMetadata()
+	assert.NoError(t, err, "Failed to read metadata fixture")
+	for _, m := range h.notifier.received() {
+		assert.Equal(t, metadata, m.Value, "Published metadata differs from the binding service response")
+		assert.NotEmpty(t, m.LastModified, "Last modified date should be set")
+	}
+}
+
+func TestPublishThrottlesReads(t *testing.T) {
+	h := newHarness(t, testContents(11, methodeAuthority, 0), RateLimits{BatchSize: 5})
+	defer h.Close()
+
+	start := time.Now()
+	err := h.mp.PublishBackfill(NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 5}))
+	assert.NoError(t, err, "Backfill should finish without error")
+
+	//5 reads per second, the first one starting straight away
+	assert.True(t, time.Since(start) >= 1800*time.Millisecond, "Reads should be throttled, took %s", time.Since(start))
+	assert.Len(t, h.notifier.received(), 11, "All contents should be published")
+}
+
+func TestPublishLimitsConcurrency(t *testing.T) {
+	h := newHarness(t, testContents(10, methodeAuthority, 0), RateLimits{BatchSize: 10, MaxConcurrency: 2})
+	defer h.Close()
+	h.bindingService.latency = 300 * time.Millisecond
+
+	err := h.mp.PublishBackfill(NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 10}))
+	assert.NoError(t, err, "Backfill should finish without error")
+
+	assert.True(t, h.bindingService.maxInFlight <= 2, "No more than 2 concurrent reads expected, got %d", h.bindingService.maxInFlight)
+	assert.Len(t, h.notifier.received(), 10, "All contents should be published")
+}
+
+func TestPublishSkipsContent(t *testing.T) {
+	contents := testContents(6, methodeAuthority, 0)
+	h := newHarness(t, contents, RateLimits{BatchSize: 5})
+	defer h.Close()
+
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 5, Skip: 4})
+	err := h.mp.PublishBackfill(b)
+	assert.NoError(t, err, "Backfill should finish without error")
+
+	assert.Equal(t, 6, b.Status().Position, "Skipped content should count towards the position")
+	assert.Equal(t, uuidsOf(contents[4:]), h.bindingService.requested(), "Skipped content should not be read")
+	assert.Equal(t, uuidsOf(contents[4:]), h.notifier.receivedUUIDs(), "Skipped content should not be published")
+}
+
+func TestPublishCancelled(t *testing.T) {
+	h := newHarness(t, testContents(20, methodeAuthority, 0), RateLimits{BatchSize: 5})
+	defer h.Close()
+
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 5})
+	time.AfterFunc(500*time.Millisecond, func() {
+		assert.NoError(t, b.Cancel(), "Failed to cancel backfill")
+	})
+	err := h.mp.PublishBackfill(b)
+	assert.NoError(t, err, "Cancelled backfill should not return an error")
+
+	status := b.Status()
+	assert.Equal(t, BackfillCancelled, status.State, "Backfill should be cancelled")
+	assert.True(t, status.Position > 0 && status.Position < 20, "Content queued after the cancellation should not be processed, position %d", status.Position)
+	assert.True(t, int64(status.Position) <= status.Published, "Position should not go beyond the published content")
+	assert.Len(t, h.notifier.received(), int(status.Published), "Only content read before the cancellation should be published")
+}
+
+func TestPublishContentStoreFailure(t *testing.T) {
+	h := newHarness(t, testContents(3, methodeAuthority, 0), RateLimits{BatchSize: 5})
+	defer h.Close()
+	h.cs.err = errors.New("cursor not found")
+
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 5})
+	err := h.mp.PublishBackfill(b)
+	assert.Error(t, err, "Expecting error when the content store fails")
+
+	status := b.Status()
+	assert.Equal(t, BackfillFailed, status.State, "Backfill should be failed")
+	assert.Equal(t, "cursor not found", status.Error, "Failure should be reported in the status")
+	assert.NotNil(t, status.FinishedAt, "Finished time should be set")
+	assert.Len(t, h.notifier.received(), 3, "Content read before the failure should be published")
+}
+
+func TestPublishThroughManager(t *testing.T) {
+	h := newHarness(t, testContents(4, methodeAuthority, 0), RateLimits{BatchSize: 2})
+	defer h.Close()
+	bm := NewBackfillManager(h.mp)
+
+	b, err := bm.Start(PublishOptions{Source: "METHODE", PreCount: true})
+	assert.NoError(t, err, "Failed to start backfill")
+	assert.Equal(t, 4, b.Status().Options.Total, "Pre-counted total should be used")
+
+	waitForBackfill(b)
+	assert.Equal(t, BackfillFinished, b.Status().State, "Backfill should be finished")
+	assert.Equal(t, 100.0, b.Status().Percent, "Finished backfill should be complete")
+	assert.Len(t, h.notifier.received(), 4, "All contents should be published")
+}
+
+func TestBackfillBatchSizeOnlyAppliesToItsRun(t *testing.T) {
+	h := newHarness(t, testContents(4, methodeAuthority, 0), RateLimits{BatchSize: 2})
+	defer h.Close()
+	bm := NewBackfillManager(h.mp)
+
+	b, err := bm.Start(PublishOptions{Source: "METHODE", BatchSize: 20})
+	assert.NoError(t, err, "Failed to start backfill")
+	assert.Equal(t, 20, h.mp.RateLimits().BatchSize, "Batch size of the backfill should be used while it runs")
+
+	waitForBackfill(b)
+	assert.Equal(t, BackfillFinished, b.Status().State, "Backfill should be finished")
+	b, err = bm.Start(PublishOptions{Source: "METHODE"})
+	assert.NoError(t, err, "Failed to start backfill")
+	assert.Equal(t, 2, b.Status().Options.BatchSize, "Next backfill should use the batch size of the service")
+	assert.Equal(t, 2, h.mp.RateLimits().BatchSize, "Batch size of the service should be restored")
+
+	//the second backfill may have finished already
+	b.Cancel()
+	waitForBackfill(b)
+	assert.NotNil(t, b.Status().FinishedAt, "Second backfill should be finished")
+}
+
+// waitForBackfill waits up to 5 seconds for the backfill to finish
+func waitForBackfill(b *Backfill) {
+	for i := 0; i < 50 && b.Status().FinishedAt == nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -1,25 +1,62 @@
 package metadata
 
 import (
+	"fmt"
+	"net/http"
 	"strings"
+
+	"github.com/bobziuchkovski/digest"
+)
+
+// Authentication schemes of the clusters
+const (
+	AuthNone   = "none"
+	AuthBasic  = "basic"
+	AuthDigest = "digest"
+	AuthBearer = "bearer"
+	AuthAPIKey = "apikey"
 )
 
+const defaultAPIKeyHeader = "X-Api-Key"
+
 type Cluster struct {
 	address  string
 	username string
 	password string
+	// credentials as configured, the token for the bearer and apikey schemes
+	credentials  string
+	auth         string
+	apiKeyHeader string
 }
 
 func GetCluster(address string, credentials string) *Cluster {
-	cluster := Cluster{address: address}
+	cluster := Cluster{address: address, credentials: credentials}
 	if credentials != "" {
-		auth := strings.Split(credentials, ":")
+		auth := strings.SplitN(credentials, ":", 2)
 		cluster.username = auth[0]
-		cluster.password = auth[1]
+		if len(auth) > 1 {
+			cluster.password = auth[1]
+		}
 	}
 	return &cluster
 }
 
+// SetAuth selects how requests to the cluster are authenticated: none, basic or digest with the username:password
+// credentials, bearer with the credentials as token or apikey with the credentials sent in the given header
+func (c *Cluster) SetAuth(scheme string, apiKeyHeader string) error {
+	switch scheme {
+	case AuthNone, AuthBasic, AuthDigest, AuthBearer, AuthAPIKey:
+	default:
+		return fmt.Errorf("Invalid authentication scheme %q for %s", scheme, c.address)
+	}
+	if (scheme == AuthBearer || scheme == AuthAPIKey) && c.credentials == "" {
+		return fmt.Errorf("No credentials for %s authentication to %s", scheme, c.address)
+	}
+	c.auth = scheme
+	c.apiKeyHeader = apiKeyHeader
+	return nil
+}
+
 func (c *Cluster) GetAddress() string {
 	return c.address
 }
@@ -31,3 +68,54 @@ func (c *Cluster) GetUsername() string {
 func (c *Cluster) GetPassword() string {
 	return c.password
 }
+
+// transport authenticates the requests sent through next with the scheme of the cluster,
+// or with defaultScheme if none was set
+func (c *Cluster) transport(defaultScheme string, next http.RoundTripper) (http.RoundTripper, error) {
+	scheme := c.auth
+	if scheme == "" {
+		scheme = defaultScheme
+	}
+	switch scheme {
+	case AuthDigest:
+		t := digest.NewTransport(c.username, c.password)
+		t.Transport = next
+		return t, nil
+	case AuthBasic:
+		return &authTransport{next: next, authorize: func(req *http.Request) {
+			req.SetBasicAuth(c.username, c.password)
+		}}, nil
+	case AuthBearer:
+		return &authTransport{next: next, authorize: func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+c.credentials)
+		}}, nil
+	case AuthAPIKey:
+		header := c.apiKeyHeader
+		if header == "" {
+			header = defaultAPIKeyHeader
+		}
+		return &authTransport{next: next, authorize: func(req *http.Request) {
+			req.Header.Set(header, c.credentials)
+		}}, nil
+	case AuthNone:
+		return next, nil
+	}
+	return nil, fmt.Errorf("Invalid authentication scheme %q for %s", scheme, c.address)
+}
+
+// authTransport adds the credentials to a copy of every request, as round trippers must not modify the request
+type authTransport struct {
+	next      http.RoundTripper
+	authorize func(req *http.Request)
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	t.authorize(r)
+	return t.next.RoundTrip(r)
+}
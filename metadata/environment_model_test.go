@@ -0,0 +1,52 @@
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterAuth(t *testing.T) {
+	var headers http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		credentials string
+		scheme      string
+		header      string
+		expected    string
+	}{
+		{"foo:bar", "", "Authorization", "Basic Zm9vOmJhcg=="},
+		{"foo:bar", AuthBasic, "Authorization", "Basic Zm9vOmJhcg=="},
+		{"foo:bar", AuthNone, "Authorization", ""},
+		{"s3cr3t", AuthBearer, "Authorization", "Bearer s3cr3t"},
+		{"s3cr3t", AuthAPIKey, "X-Api-Key", "s3cr3t"},
+		{"key:with:colons", AuthAPIKey, "X-Gateway-Key", "key:with:colons"},
+	}
+	for _, test := range tests {
+		cluster := GetCluster(ts.URL, test.credentials)
+		if test.scheme != "" {
+			assert.NoError(t, cluster.SetAuth(test.scheme, test.header), "Failed to set %s authentication", test.scheme)
+		}
+		tr, err := cluster.transport(AuthBasic, http.DefaultTransport)
+		assert.NoError(t, err, "Failed to create transport")
+
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		resp, err := (&http.Client{Transport: tr}).Do(req)
+		assert.NoError(t, err, "Request failed")
+		resp.Body.Close()
+		assert.Equal(t, test.expected, headers.Get(test.header), "Unexpected %s header with %q authentication", test.header, test.scheme)
+		assert.Empty(t, req.Header, "Original request should not be modified")
+	}
+}
+
+func TestClusterSetAuthInvalid(t *testing.T) {
+	assert.Error(t, GetCluster("http://localhost", "foo:bar").SetAuth("kerberos", ""), "Expecting error for unknown scheme")
+	assert.Error(t, GetCluster("http://localhost", "").SetAuth(AuthBearer, ""), "Expecting error for bearer without token")
+	assert.NoError(t, GetCluster("http://localhost", "").SetAuth(AuthBasic, ""), "Basic without credentials should be allowed as before")
+}
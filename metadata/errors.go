@@ -0,0 +1,75 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kinds of failures to read or publish the metadata of a content item
+const (
+	ErrorNotFound        = "not_found"
+	ErrorUnauthorized    = "unauthorized"
+	ErrorThrottled       = "throttled"
+	ErrorUpstream        = "upstream_error"
+	ErrorInvalidSource   = "invalid_source"
+	ErrorInvalidMetadata = "invalid_metadata"
+)
+
+// ErrNoMetadata is returned by ReadService implementations when there is no metadata for the content,
+// which is nothing to publish rather than a failure
+var ErrNoMetadata = errors.New("No metadata for content")
+
+// ContentError is a failure to read or publish the metadata of a content item
+type ContentError struct {
+	Kind  string
+	Stage string
+	// Status is the status code of the response, 0 if there was none
+	Status int
+	Msg    string
+}
+
+func (e *ContentError) Error() string {
+	return e.Msg
+}
+
+// statusError classifies an unexpected response of the service called at the stage; only the binding
+// service answers 404 for missing content, the notifier doing so is misconfigured
+func statusError(stage string, status int, service string) *ContentError {
+	kind := ErrorUpstream
+	switch {
+	case status == http.StatusNotFound && stage == stageRead:
+		kind = ErrorNotFound
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		kind = ErrorUnauthorized
+	case status == http.StatusTooManyRequests:
+		kind = ErrorThrottled
+	}
+	return &ContentError{Kind: kind, Stage: stage, Status: status, Msg: fmt.Sprintf("Received response with status code %d from %s", status, service)}
+}
+
+// upstreamError is a failure to get any response from the service called at the stage
+func upstreamError(stage string, format string, args ...interface{}) *ContentError {
+	return &ContentError{Kind: ErrorUpstream, Stage: stage, Msg: fmt.Sprintf(format, args...)}
+}
+
+// errorKind returns the kind of a failure, ErrorUpstream for errors not telling more
+func errorKind(err error) string {
+	switch e := err.(type) {
+	case *ContentError:
+		return e.Kind
+	case *InvalidMetadataError:
+		return ErrorInvalidMetadata
+	}
+	return ErrorUpstream
+}
+
+// isUnavailable tells whether the failure means that the service is not working, as opposed to
+// a response about the content itself; reads failing that way are retried
+func isUnavailable(err error) bool {
+	e, ok := err.(*ContentError)
+	if !ok {
+		return false
+	}
+	return e.Kind == ErrorThrottled || (e.Kind == ErrorUpstream && (e.Status == 0 || e.Status >= 500))
+}
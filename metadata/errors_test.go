@@ -0,0 +1,109 @@
+package metadata
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadByUUIDErrorKinds(t *testing.T) {
+	tests := []struct {
+		status      int
+		kind        string
+		unavailable bool
+	}{
+		{http.StatusNotFound, ErrorNotFound, false},
+		{http.StatusUnauthorized, ErrorUnauthorized, false},
+		{http.StatusForbidden, ErrorUnauthorized, false},
+		{http.StatusTooManyRequests, ErrorThrottled, true},
+		{http.StatusBadGateway, ErrorUpstream, true},
+		{http.StatusBadRequest, ErrorUpstream, false},
+	}
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+		}))
+		reader, err := NewV1MetadataReadService(&Cluster{address: ts.URL + BindingServiceURL})
+		assert.NoError(t, err, "Failed to initialise metadata reader")
+		_, err = reader.ReadByUUID(testContent, ReadRun{})
+		ts.Close()
+
+		contentErr, ok := err.(*ContentError)
+		if assert.True(t, ok, "Expecting ContentError for status %d, got %T", test.status, err) {
+			assert.Equal(t, test.kind, contentErr.Kind, "Unexpected kind for status %d", test.status)
+			assert.Equal(t, stageRead, contentErr.Stage, "Unexpected stage for status %d", test.status)
+			assert.Equal(t, test.status, contentErr.Status, "Unexpected status code")
+		}
+		assert.Equal(t, test.unavailable, isUnavailable(err), "Unexpected retry decision for status %d", test.status)
+	}
+}
+
+func TestReadByUUIDNoMetadata(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	reader, err := NewV1MetadataReadService(&Cluster{address: ts.URL + BindingServiceURL})
+	assert.NoError(t, err, "Failed to initialise metadata reader")
+	_, err = reader.ReadByUUID(testContent, ReadRun{})
+	assert.Equal(t, ErrNoMetadata, err, "Expecting no metadata for 204")
+}
+
+func TestReadByUUIDInvalidSource(t *testing.T) {
+	reader, err := NewV1MetadataReadService(&Cluster{address: "http://localhost" + BindingServiceURL})
+	assert.NoError(t, err, "Failed to initialise metadata reader")
+	_, err = reader.ReadByUUID(Content{UUID: testContent.UUID}, ReadRun{})
+	assert.Equal(t, ErrorInvalidSource, errorKind(err), "Expecting invalid source")
+}
+
+func TestErrorKind(t *testing.T) {
+	assert.Equal(t, ErrorInvalidMetadata, errorKind(&InvalidMetadataError{Category: InvalidMalformed}), "Unexpected kind")
+	assert.Equal(t, ErrorUpstream, errorKind(errors.New("Connection refused")), "Untyped errors should be upstream errors")
+	assert.False(t, isUnavailable(errors.New("Connection refused")), "Untyped errors should not be retried")
+}
+
+func TestPublishCountsFailuresByKind(t *testing.T) {
+	contents := testContents(6, methodeAuthority, 0)
+	h := newHarness(t, contents, RateLimits{BatchSize: 10})
+	defer h.Close()
+	h.bindingService.failures[contents[0].UUID] = http.StatusNotFound
+	h.bindingService.failures[contents[1].UUID] = http.StatusNotFound
+	h.bindingService.failures[contents[2].UUID] = http.StatusUnauthorized
+	h.bindingService.noMetadata[contents[3].UUID] = true
+	h.notifier.failures[contents[4].UUID] = http.StatusTooManyRequests
+
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 10})
+	err := h.mp.PublishBackfill(b)
+	assert.NoError(t, err, "Backfill should finish without error")
+
+	status := b.Status()
+	assert.Equal(t, int64(1), status.Published, "Unexpected number of published contents")
+	assert.Equal(t, int64(1), status.NoMetadata, "Unexpected number of contents without metadata")
+	assert.Equal(t, map[string]int64{ErrorNotFound: 2, ErrorUnauthorized: 1, ErrorThrottled: 1}, status.FailedBy, "Unexpected failures by kind")
+}
+
+func TestNotifierNotFoundIsUpstreamError(t *testing.T) {
+	err := statusError(stagePublish, http.StatusNotFound, "notifier")
+	assert.Equal(t, ErrorUpstream, err.Kind, "A 404 from the notifier is not about the content")
+	assert.Equal(t, http.StatusBadGateway, publishStatus(PublishReport{Failed: 1, FailedBy: map[string]int{err.Kind: 1}}), "Unexpected status for a missing notifier")
+
+	contents := testContents(1, methodeAuthority, 0)
+	h := newHarness(t, contents, RateLimits{BatchSize: 10})
+	defer h.Close()
+	h.notifier.failures[contents[0].UUID] = http.StatusNotFound
+
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 10})
+	assert.NoError(t, h.mp.PublishBackfill(b), "Backfill should finish without error")
+	assert.Equal(t, map[string]int64{ErrorUpstream: 1}, b.Status().FailedBy, "Unexpected failures by kind")
+}
+
+func TestPublishStatus(t *testing.T) {
+	assert.Equal(t, http.StatusOK, publishStatus(PublishReport{Accepted: 2}), "Unexpected status without failures")
+	assert.Equal(t, http.StatusUnprocessableEntity, publishStatus(PublishReport{Failed: 2, FailedBy: map[string]int{ErrorNotFound: 1, ErrorInvalidMetadata: 1}}), "Unexpected status for content failures")
+	assert.Equal(t, http.StatusServiceUnavailable, publishStatus(PublishReport{Failed: 2, FailedBy: map[string]int{ErrorNotFound: 1, ErrorThrottled: 1}}), "Unexpected status for throttled requests")
+	assert.Equal(t, http.StatusBadGateway, publishStatus(PublishReport{Failed: 2, FailedBy: map[string]int{ErrorThrottled: 1, ErrorUnauthorized: 1}}), "Unexpected status for upstream failures")
+}
@@ -0,0 +1,176 @@
+package metadata
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultFaultTimeout = 30 * time.Second
+
+// FaultConfig describes the failures injected by a FaultTransport, rates being fractions of the requests between 0 and 1
+type FaultConfig struct {
+	Latency     time.Duration
+	LatencyRate float64
+	ResetRate   float64
+	TimeoutRate float64
+	// TimeoutAfter is how long a request hangs before failing with a timeout
+	TimeoutAfter time.Duration
+	StatusRates  map[int]float64
+	Seed         int64
+}
+
+// ParseFaultConfig reads a comma separated list of faults, e.g.
+// "latency=200ms,latencyRate=0.5,reset=0.01,timeout=0.01,timeoutAfter=5s,503=0.05,seed=42"
+func ParseFaultConfig(spec string) (FaultConfig, error) {
+	c := FaultConfig{LatencyRate: 1, TimeoutAfter: defaultFaultTimeout, StatusRates: map[int]float64{}, Seed: time.Now().UnixNano()}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return c, fmt.Errorf("Invalid fault %q, expecting key=value", part)
+		}
+		key, value := kv[0], kv[1]
+		var err error
+		switch key {
+		case "latency":
+			c.Latency, err = time.ParseDuration(value)
+		case "latencyRate":
+			c.LatencyRate, err = parseRate(value)
+		case "reset":
+			c.ResetRate, err = parseRate(value)
+		case "timeout":
+			c.TimeoutRate, err = parseRate(value)
+		case "timeoutAfter":
+			c.TimeoutAfter, err = time.ParseDuration(value)
+		case "seed":
+			c.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			status, convErr := strconv.Atoi(key)
+			if convErr != nil || status < 100 || status > 599 {
+				return c, fmt.Errorf("Unknown fault %q", key)
+			}
+			c.StatusRates[status], err = parseRate(value)
+		}
+		if err != nil {
+			return c, fmt.Errorf("Invalid value of fault %s: %s", key, err)
+		}
+	}
+	return c, c.validate()
+}
+
+func parseRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("rate must be between 0 and 1, got %s", s)
+	}
+	return rate, nil
+}
+
+func (c FaultConfig) validate() error {
+	total := c.ResetRate + c.TimeoutRate
+	for _, rate := range c.StatusRates {
+		total += rate
+	}
+	if total > 1 {
+		return fmt.Errorf("The rates of resets, timeouts and status codes add up to %g, more than 1", total)
+	}
+	return nil
+}
+
+// FaultTransport wraps a RoundTripper, delaying requests and failing them
+// with connection resets, timeouts or status codes at the configured rates
+type FaultTransport struct {
+	Transport http.RoundTripper
+	config    FaultConfig
+	statuses  []int
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func NewFaultTransport(t http.RoundTripper, config FaultConfig) *FaultTransport {
+	statuses := []int{}
+	for status := range config.StatusRates {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	return &FaultTransport{Transport: t, config: config, statuses: statuses, rand: rand.New(rand.NewSource(config.Seed))}
+}
+
+func (t *FaultTransport) roll() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rand.Float64()
+}
+
+// faultTimeoutError behaves like the error of a request timing out
+type faultTimeoutError struct{}
+
+func (faultTimeoutError) Error() string   { return "injected fault: i/o timeout" }
+func (faultTimeoutError) Timeout() bool   { return true }
+func (faultTimeoutError) Temporary() bool { return true }
+
+func (t *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.config.Latency > 0 && t.roll() < t.config.LatencyRate {
+		select {
+		case <-time.After(t.config.Latency):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	r := t.roll()
+	threshold := t.config.ResetRate
+	if r < threshold {
+		closeBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+	threshold += t.config.TimeoutRate
+	if r < threshold {
+		closeBody(req)
+		select {
+		case <-time.After(t.config.TimeoutAfter):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: faultTimeoutError{}}
+	}
+	for _, status := range t.statuses {
+		threshold += t.config.StatusRates[status]
+		if r < threshold {
+			closeBody(req)
+			return &http.Response{
+				Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+				StatusCode: status,
+				Proto:      "HTTP/1.1",
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header:     http.Header{"X-Injected-Fault": []string{"true"}},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+				Request:    req,
+			}, nil
+		}
+	}
+	return t.Transport.RoundTrip(req)
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
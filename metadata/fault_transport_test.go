@@ -0,0 +1,114 @@
+package metadata
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingTransport struct {
+	requests int64
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.requests, 1)
+	w := httptest.NewRecorder()
+	w.WriteHeader(http.StatusOK)
+	return w.Result(), nil
+}
+
+func TestParseFaultConfig(t *testing.T) {
+	c, err := ParseFaultConfig("latency=200ms, latencyRate=0.5,reset=0.01,timeout=0.02,timeoutAfter=5s,503=0.05,429=0.1,seed=42")
+	assert.NoError(t, err, "Failed to parse faults")
+	assert.Equal(t, 200*time.Millisecond, c.Latency, "Unexpected latency")
+	assert.Equal(t, 0.5, c.LatencyRate, "Unexpected latency rate")
+	assert.Equal(t, 0.01, c.ResetRate, "Unexpected reset rate")
+	assert.Equal(t, 0.02, c.TimeoutRate, "Unexpected timeout rate")
+	assert.Equal(t, 5*time.Second, c.TimeoutAfter, "Unexpected timeout")
+	assert.Equal(t, map[int]float64{503: 0.05, 429: 0.1}, c.StatusRates, "Unexpected status rates")
+	assert.Equal(t, int64(42), c.Seed, "Unexpected seed")
+
+	c, err = ParseFaultConfig("latency=1s")
+	assert.NoError(t, err, "Failed to parse faults")
+	assert.Equal(t, 1.0, c.LatencyRate, "Latency should apply to every request by default")
+
+	for _, spec := range []string{"reset=2", "foo=0.1", "503", "700=0.1", "reset=0.6,503=0.6", "latency=fast"} {
+		_, err = ParseFaultConfig(spec)
+		assert.Error(t, err, "Expecting error for faults %q", spec)
+	}
+}
+
+func TestFaultTransportPassesThrough(t *testing.T) {
+	inner := &countingTransport{}
+	ft := NewFaultTransport(inner, FaultConfig{})
+
+	resp, err := ft.RoundTrip(httptest.NewRequest("GET", "http://localhost/", nil))
+	assert.NoError(t, err, "Request without faults should succeed")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Unexpected status code")
+	assert.Equal(t, int64(1), inner.requests, "Request should be sent")
+}
+
+func TestFaultTransportInjectsStatus(t *testing.T) {
+	inner := &countingTransport{}
+	ft := NewFaultTransport(inner, FaultConfig{StatusRates: map[int]float64{http.StatusServiceUnavailable: 1}})
+
+	resp, err := ft.RoundTrip(httptest.NewRequest("GET", "http://localhost/", nil))
+	assert.NoError(t, err, "Injected status should not be an error")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "Unexpected status code")
+	assert.Equal(t, int64(0), inner.requests, "Request should not be sent")
+}
+
+func TestFaultTransportInjectsReset(t *testing.T) {
+	ft := NewFaultTransport(&countingTransport{}, FaultConfig{ResetRate: 1})
+
+	_, err := ft.RoundTrip(httptest.NewRequest("GET", "http://localhost/", nil))
+	assert.IsType(t, &net.OpError{}, err, "Expecting a network error")
+	assert.Contains(t, err.Error(), "connection reset", "Unexpected error")
+}
+
+func TestFaultTransportInjectsTimeout(t *testing.T) {
+	ft := NewFaultTransport(&countingTransport{}, FaultConfig{TimeoutRate: 1, TimeoutAfter: 10 * time.Millisecond})
+
+	start := time.Now()
+	_, err := ft.RoundTrip(httptest.NewRequest("GET", "http://localhost/", nil))
+	netErr, ok := err.(net.Error)
+	assert.True(t, ok && netErr.Timeout(), "Expecting a timeout, got %v", err)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond, "Request should hang before timing out")
+}
+
+func TestFaultTransportRates(t *testing.T) {
+	inner := &countingTransport{}
+	ft := NewFaultTransport(inner, FaultConfig{StatusRates: map[int]float64{http.StatusTooManyRequests: 0.3}, Seed: 1})
+
+	throttled := 0
+	for i := 0; i < 1000; i++ {
+		resp, err := ft.RoundTrip(httptest.NewRequest("GET", "http://localhost/", nil))
+		assert.NoError(t, err, "Injected status should not be an error")
+		if resp.StatusCode == http.StatusTooManyRequests {
+			throttled++
+		}
+	}
+	assert.InDelta(t, 300, throttled, 60, "Unexpected number of injected failures")
+	assert.Equal(t, int64(1000-throttled), inner.requests, "Requests without faults should be sent")
+}
+
+func TestPublishWithInjectedFaults(t *testing.T) {
+	h := newHarness(t, testContents(20, methodeAuthority, 0), RateLimits{BatchSize: 20})
+	defer h.Close()
+	h.mp.mr.(*V1MetadataReadService).InjectFaults(FaultConfig{ResetRate: 0.25, Seed: 3})
+	h.mp.InjectFaults(FaultConfig{StatusRates: map[int]float64{http.StatusServiceUnavailable: 0.25}, Seed: 5})
+
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 20})
+	err := h.mp.PublishBackfill(b)
+	assert.NoError(t, err, "Backfill should finish despite failures")
+
+	status := b.Status()
+	assert.Equal(t, int64(20), status.Published+status.Failed, "Every content item should be accounted for")
+	assert.True(t, status.Failed > 0, "Injected faults should cause failures")
+	assert.Len(t, h.notifier.received(), int(status.Published), "Only successful publishes should reach the notifier")
+}
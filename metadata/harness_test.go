@@ -0,0 +1,278 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const methodeAuthority = "http://api.ft.com/system/FTCOM-METHODE"
+
+// memoryContentService serves content from memory, in the order given, the way the content store is scanned
+type memoryContentService struct {
+	contents []Content
+	// err is reported once all the content has been streamed, as a failing cursor would
+	err error
+}
+
+func (cs *memoryContentService) GetContent(source string, stop <-chan struct{}, errCh chan error) chan Content {
+	result := make(chan Content)
+	go func() {
+		defer close(result)
+		for _, c := range cs.contents {
+			if s, ok := c.getSource(); !ok || s != source {
+				continue
+			}
+			select {
+			case result <- c:
+			case <-stop:
+				return
+			}
+		}
+		if cs.err != nil {
+			errCh <- cs.err
+		}
+	}()
+	return result
+}
+
+func (cs *memoryContentService) GetContentByUUIDs(uuids []string) ([]Content, error) {
+	wanted := map[string]bool{}
+	for _, uuid := range uuids {
+		wanted[uuid] = true
+	}
+	result := []Content{}
+	for _, c := range cs.contents {
+		if wanted[c.UUID] {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func (cs *memoryContentService) CountContent(source string) (int, error) {
+	count := 0
+	for _, c := range cs.contents {
+		if s, ok := c.getSource(); ok && s == source {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// fakeBindingService stands in for the binding service, serving the metadata fixture
+// for every UUID apart from the ones configured to have no metadata, to fail or to answer with an HTML page
+type fakeBindingService struct {
+	*httptest.Server
+	metadata   []byte
+	noMetadata map[string]bool
+	failures   map[string]int
+	invalid    map[string]bool
+	latency    time.Duration
+
+	mu          sync.Mutex
+	down        bool
+	requests    []string
+	inFlight    int
+	maxInFlight int
+}
+
+func newFakeBindingService(t *testing.T) *fakeBindingService {
+	metadata, err := getMetadata()
+	assert.NoError(t, err, "Failed to read metadata fixture")
+	bs := &fakeBindingService{
+		metadata:   metadata,
+		noMetadata: map[string]bool{},
+		failures:   map[string]int{},
+		invalid:    map[string]bool{},
+	}
+	r := mux.NewRouter()
+	r.HandleFunc(BindingServiceURL, bs.serve).Methods("GET")
+	bs.Server = httptest.NewServer(r)
+	return bs
+}
+
+func (bs *fakeBindingService) serve(w http.ResponseWriter, r *http.Request) {
+	uuid := mux.Vars(r)["uuid"]
+	bs.mu.Lock()
+	bs.requests = append(bs.requests, uuid)
+	bs.inFlight++
+	if bs.inFlight > bs.maxInFlight {
+		bs.maxInFlight = bs.inFlight
+	}
+	status, failing := bs.failures[uuid]
+	if bs.down {
+		status, failing = http.StatusServiceUnavailable, true
+	}
+	noMetadata := bs.noMetadata[uuid]
+	invalid := bs.invalid[uuid]
+	bs.mu.Unlock()
+	defer func() {
+		bs.mu.Lock()
+		bs.inFlight--
+		bs.mu.Unlock()
+	}()
+
+	time.Sleep(bs.latency)
+	switch {
+	case failing:
+		w.WriteHeader(status)
+	case noMetadata:
+		w.WriteHeader(http.StatusNoContent)
+	case invalid:
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(maintenancePage))
+	default:
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(bs.metadata)
+	}
+}
+
+// setDown makes every request fail with a 503 until set back
+func (bs *fakeBindingService) setDown(down bool) {
+	bs.mu.Lock()
+	bs.down = down
+	bs.mu.Unlock()
+}
+
+func (bs *fakeBindingService) requested() []string {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	requests := append([]string{}, bs.requests...)
+	sort.Strings(requests)
+	return requests
+}
+
+func (bs *fakeBindingService) cluster() *Cluster {
+	return &Cluster{address: bs.URL + BindingServiceURL, username: "foo", password: "bar"}
+}
+
+type notification struct {
+	UUID         string       `json:"uuid"`
+	LastModified string       `json:"lastModified"`
+	Value        []byte       `json:"value"`
+	Annotations  []Annotation `json:"annotations"`
+	ReceivedAt   time.Time    `json:"-"`
+}
+
+// recordingNotifier stands in for the metadata notifier, recording every publish it receives
+type recordingNotifier struct {
+	*httptest.Server
+	failures map[string]int
+	latency  time.Duration
+
+	mu            sync.Mutex
+	notifications []notification
+	inFlight      int
+	maxInFlight   int
+}
+
+func newRecordingNotifier(t *testing.T) *recordingNotifier {
+	n := &recordingNotifier{failures: map[string]int{}}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "binding-service", r.Header.Get("X-Origin-System-Id"), "Invalid X-Origin-System-Id header value")
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"), "Invalid Content-Type header value")
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok && username == "foo" && password == "bar", "Publish request should be authenticated")
+
+		var m notification
+		err := json.NewDecoder(r.Body).Decode(&m)
+		assert.NoError(t, err, "Failed to decode published metadata")
+		m.ReceivedAt = time.Now()
+		n.mu.Lock()
+		n.notifications = append(n.notifications, m)
+		status, failing := n.failures[m.UUID]
+		n.inFlight++
+		if n.inFlight > n.maxInFlight {
+			n.maxInFlight = n.inFlight
+		}
+		n.mu.Unlock()
+		defer func() {
+			n.mu.Lock()
+			n.inFlight--
+			n.mu.Unlock()
+		}()
+
+		time.Sleep(n.latency)
+
+		w.Header().Set("X-Request-Id", "tid_"+m.UUID)
+		if failing {
+			w.WriteHeader(status)
+		}
+	}))
+	return n
+}
+
+func (n *recordingNotifier) received() []notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]notification{}, n.notifications...)
+}
+
+func (n *recordingNotifier) receivedUUIDs() []string {
+	uuids := []string{}
+	for _, m := range n.received() {
+		uuids = append(uuids, m.UUID)
+	}
+	sort.Strings(uuids)
+	return uuids
+}
+
+func (n *recordingNotifier) cluster() *Cluster {
+	return &Cluster{address: n.URL + "/__cms-metadata-notifier/notify", username: "foo", password: "bar"}
+}
+
+// harness wires a publish service to in-memory content, the fake binding service and the recording notifier
+type harness struct {
+	cs             *memoryContentService
+	bindingService *fakeBindingService
+	notifier       *recordingNotifier
+	mp             *V1MetadataPublishService
+}
+
+func newHarness(t *testing.T, contents []Content, limits RateLimits) *harness {
+	h := &harness{
+		cs:             &memoryContentService{contents: contents},
+		bindingService: newFakeBindingService(t),
+		notifier:       newRecordingNotifier(t),
+	}
+	reader, err := NewV1MetadataReadService(h.bindingService.cluster())
+	assert.NoError(t, err, "Failed to initialise metadata reader")
+	h.mp, err = NewV1MetadataPublishService(h.cs, h.notifier.cluster(), reader, "METHODE", limits)
+	assert.NoError(t, err, "Failed to initialise publish service")
+	return h
+}
+
+func (h *harness) Close() {
+	h.bindingService.Close()
+	h.notifier.Close()
+}
+
+// testContents returns n content items of the source identified by the authority, with UUIDs in ascending order
+func testContents(n int, authority string, offset int) []Content {
+	contents := []Content{}
+	for i := offset; i < offset+n; i++ {
+		contents = append(contents, Content{
+			UUID:        fmt.Sprintf("%08d-0000-0000-0000-%012d", i, i),
+			Identifiers: []Identifier{{Authority: authority}},
+		})
+	}
+	return contents
+}
+
+func uuidsOf(contents []Content) []string {
+	uuids := []string{}
+	for _, c := range contents {
+		uuids = append(uuids, c.UUID)
+	}
+	sort.Strings(uuids)
+	return uuids
+}
@@ -2,9 +2,16 @@ package metadata
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"sort"
 	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 )
 
 var transport = &http.Transport{
@@ -22,35 +29,301 @@ var transport = &http.Transport{
 	MaxIdleConnsPerHost:   1000,
 }
 
+const maxPublishRequestSize = 10 << 20
+
+var errBodyTooLarge = errors.New("Request body too large")
+
+// limitedBody fails reads with errBodyTooLarge once the body turns out to be larger than the limit
+type limitedBody struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	//read one byte more than allowed to tell a body of exactly the limit from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.r.Read(p)
+	if int64(n) > b.remaining {
+		b.exceeded = true
+		n = int(b.remaining)
+		b.remaining = 0
+		return n, errBodyTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
 type HttpHandler struct {
 	mp PublishService
+	bm *BackfillManager
+	cs ContentService
+	l  Ledger
+}
+
+func NewHttpHandler(mp PublishService, bm *BackfillManager, cs ContentService, l Ledger) *HttpHandler {
+	return &HttpHandler{mp: mp, bm: bm, cs: cs, l: l}
+}
+
+type PublishReport struct {
+	Accepted int             `json:"accepted"`
+	Failed   int             `json:"failed"`
+	FailedBy map[string]int  `json:"failedBy,omitempty"`
+	Rejected []RejectedEntry `json:"rejected"`
 }
 
-func NewHttpHandler(mp PublishService) *HttpHandler {
-	return &HttpHandler{mp: mp}
+type RejectedEntry struct {
+	Index int    `json:"index"`
+	UUID  string `json:"uuid,omitempty"`
+	Error string `json:"error"`
 }
 
 func (h *HttpHandler) Publish(w http.ResponseWriter, r *http.Request) {
-	decoder := json.NewDecoder(r.Body)
-	var ids []Content
-	err := decoder.Decode(&ids)
+	body := &limitedBody{r: r.Body, remaining: maxPublishRequestSize}
+	decoder := json.NewDecoder(body)
+	var items []json.RawMessage
+	err := decoder.Decode(&items)
+	if body.exceeded {
+		writeJSONMessage(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body larger than %d bytes", maxPublishRequestSize))
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeJSONMessage(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %s", err))
 		return
 	}
 	defer r.Body.Close()
 
+	valid, rejected, err := h.resolveContent(items)
+	if err != nil {
+		log.WithField(stageField, stageAPI).WithError(err).Error("Resolving submitted content failed")
+		writeJSONMessage(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	report := PublishReport{Accepted: len(valid), Rejected: rejected}
+	if len(valid) == 0 {
+		writeJSON(w, http.StatusBadRequest, report)
+		return
+	}
+
 	errorCh := make(chan error)
 	doneCh := make(chan bool)
-	go h.mp.SendMetadataJob(ids, errorCh, doneCh)
+	go h.mp.SendMetadataJob(valid, errorCh, doneCh)
 	for {
 		select {
 		case err := <-errorCh:
-			log.Error(err)
-			w.WriteHeader(http.StatusInternalServerError)
+			if report.FailedBy == nil {
+				report.FailedBy = map[string]int{}
+			}
+			report.Failed++
+			report.FailedBy[errorKind(err)]++
 		case <-doneCh:
-			log.Infof("Finished importing %d contents", len(ids))
+			log.WithFields(logrus.Fields{
+				stageField: stageAPI,
+				"accepted": report.Accepted,
+				"rejected": len(report.Rejected),
+				"failed":   report.Failed,
+			}).Info("Finished importing contents")
+			writeJSON(w, publishStatus(report), report)
 			return
 		}
 	}
 }
+
+// publishStatus tells whether the submitted content was published, and if not, whose fault it was: 502 when the
+// binding service or notifier failed, 503 when they throttled the requests, 422 when only the content itself was the problem
+func publishStatus(report PublishReport) int {
+	if report.Failed == 0 {
+		return http.StatusOK
+	}
+	if report.FailedBy[ErrorUpstream] > 0 || report.FailedBy[ErrorUnauthorized] > 0 {
+		return http.StatusBadGateway
+	}
+	if report.FailedBy[ErrorThrottled] > 0 {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// resolveContent validates the submitted content, which can be given either as content with identifiers
+// or as plain UUIDs whose identifiers are looked up in the content store
+func (h *HttpHandler) resolveContent(items []json.RawMessage) ([]Content, []RejectedEntry, error) {
+	valid := []Content{}
+	rejected := []RejectedEntry{}
+	//positions of every UUID to look up, as a UUID can be submitted more than once
+	lookups := map[string][]int{}
+	uuids := []string{}
+
+	for i, item := range items {
+		var uuid string
+		if json.Unmarshal(item, &uuid) == nil {
+			if !uuidRegexp.MatchString(uuid) {
+				rejected = append(rejected, RejectedEntry{Index: i, UUID: uuid, Error: fmt.Sprintf("Invalid UUID %q", uuid)})
+				continue
+			}
+			if _, ok := lookups[uuid]; !ok {
+				uuids = append(uuids, uuid)
+			}
+			lookups[uuid] = append(lookups[uuid], i)
+			continue
+		}
+
+		var content Content
+		err := json.Unmarshal(item, &content)
+		if err == nil {
+			err = content.validate()
+		}
+		if err != nil {
+			rejected = append(rejected, RejectedEntry{Index: i, UUID: content.UUID, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, content)
+	}
+
+	if len(uuids) > 0 {
+		contents, err := h.cs.GetContentByUUIDs(uuids)
+		if err != nil {
+			return nil, nil, err
+		}
+		found := map[string]bool{}
+		for _, content := range contents {
+			found[content.UUID] = true
+			err := content.validate()
+			if err != nil {
+				for _, i := range lookups[content.UUID] {
+					rejected = append(rejected, RejectedEntry{Index: i, UUID: content.UUID, Error: err.Error()})
+				}
+				continue
+			}
+			valid = append(valid, content)
+		}
+		for _, uuid := range uuids {
+			if found[uuid] {
+				continue
+			}
+			for _, i := range lookups[uuid] {
+				rejected = append(rejected, RejectedEntry{Index: i, UUID: uuid, Error: "Content not found in the content store"})
+			}
+		}
+	}
+
+	sort.Slice(rejected, func(i, j int) bool { return rejected[i].Index < rejected[j].Index })
+	return valid, rejected, nil
+}
+
+func (h *HttpHandler) StartBackfill(w http.ResponseWriter, r *http.Request) {
+	options := PublishOptions{MaxCountDeviation: DefaultMaxCountDeviation}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&options)
+		if err != nil {
+			writeJSONMessage(w, http.StatusBadRequest, fmt.Sprintf("Invalid backfill options: %s", err))
+			return
+		}
+		defer r.Body.Close()
+	}
+	if options.Source != "" && !isKnownSource(options.Source) {
+		writeJSONMessage(w, http.StatusBadRequest, fmt.Sprintf("Unknown source %s", options.Source))
+		return
+	}
+
+	b, err := h.bm.Start(options)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == ErrBackfillInProgress {
+			status = http.StatusConflict
+		} else if _, ok := err.(*CountMismatchError); ok {
+			status = http.StatusPreconditionFailed
+		}
+		writeJSONMessage(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, b.Status())
+}
+
+func (h *HttpHandler) PauseBackfill(w http.ResponseWriter, r *http.Request) {
+	h.controlBackfill(w, "paused", (*Backfill).Pause)
+}
+
+func (h *HttpHandler) ResumeBackfill(w http.ResponseWriter, r *http.Request) {
+	h.controlBackfill(w, "resumed", (*Backfill).Resume)
+}
+
+func (h *HttpHandler) CancelBackfill(w http.ResponseWriter, r *http.Request) {
+	h.controlBackfill(w, "cancelled", (*Backfill).Cancel)
+}
+
+func (h *HttpHandler) BackfillStatus(w http.ResponseWriter, r *http.Request) {
+	b, err := h.bm.Current()
+	if err != nil {
+		writeJSONMessage(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, b.Status())
+}
+
+func (h *HttpHandler) GetRateLimits(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.mp.RateLimits())
+}
+
+func (h *HttpHandler) SetRateLimits(w http.ResponseWriter, r *http.Request) {
+	limits := h.mp.RateLimits()
+	err := json.NewDecoder(r.Body).Decode(&limits)
+	if err != nil {
+		writeJSONMessage(w, http.StatusBadRequest, fmt.Sprintf("Invalid rate limits: %s", err))
+		return
+	}
+	defer r.Body.Close()
+
+	err = h.mp.SetRateLimits(limits)
+	if err != nil {
+		writeJSONMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, h.mp.RateLimits())
+}
+
+func (h *HttpHandler) History(w http.ResponseWriter, r *http.Request) {
+	if h.l == nil {
+		writeJSONMessage(w, http.StatusNotFound, "The publish ledger is not enabled")
+		return
+	}
+	uuid := mux.Vars(r)["uuid"]
+	if !uuidRegexp.MatchString(uuid) {
+		writeJSONMessage(w, http.StatusBadRequest, fmt.Sprintf("Invalid UUID %q", uuid))
+		return
+	}
+
+	history, err := h.l.History(uuid)
+	if err != nil {
+		log.WithFields(logrus.Fields{uuidField: uuid, stageField: stageAPI}).WithError(err).Error("Reading publish history failed")
+		writeJSONMessage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+func (h *HttpHandler) controlBackfill(w http.ResponseWriter, action string, control func(*Backfill) error) {
+	b, err := h.bm.Current()
+	if err != nil {
+		writeJSONMessage(w, http.StatusNotFound, err.Error())
+		return
+	}
+	err = control(b)
+	if err != nil {
+		writeJSONMessage(w, http.StatusConflict, err.Error())
+		return
+	}
+	log.WithFields(logrus.Fields{runIDField: b.ID, stageField: stageBackfill}).Infof("Backfill %s", action)
+	writeJSON(w, http.StatusOK, b.Status())
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeJSONMessage(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
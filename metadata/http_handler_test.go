@@ -0,0 +1,181 @@
+package metadata
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockPublishService struct {
+	published []Content
+}
+
+func (mp *MockPublishService) Publish() error {
+	return nil
+}
+
+func (mp *MockPublishService) SendMetadataJob(contents []Content, errorsCh chan error, doneCh chan bool) {
+	mp.published = append(mp.published, contents...)
+	doneCh <- true
+}
+
+func (mp *MockPublishService) RateLimits() RateLimits {
+	return RateLimits{BatchSize: 10}
+}
+
+func (mp *MockPublishService) SetRateLimits(limits RateLimits) error {
+	return nil
+}
+
+func (mp *MockPublishService) SubscribeFailures() (<-chan FailureEvent, func()) {
+	return make(chan FailureEvent), func() {}
+}
+
+func TestPublishRejectsInvalidContent(t *testing.T) {
+	mp := &MockPublishService{}
+	h := NewHttpHandler(mp, nil, nil, nil)
+	body := `[
+		{"uuid": "0cd42702-f789-11e6-9516-2d969e0d3b65", "identifiers": [{"authority": "http://api.ft.com/system/FTCOM-METHODE"}]},
+		{"uuid": "0cd42702-f789-11e6-9516-2d969e0d3b66", "identifiers": []}
+	]`
+
+	w := httptest.NewRecorder()
+	h.Publish(w, httptest.NewRequest("POST", "/metadata/publish", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusOK, w.Code, "Unexpected status code")
+	var report PublishReport
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&report), "Failed to decode publish report")
+	assert.Equal(t, 1, report.Accepted, "Unexpected number of accepted contents")
+	assert.Len(t, report.Rejected, 1, "Unexpected number of rejected contents")
+	assert.Equal(t, 1, report.Rejected[0].Index, "Unexpected index of rejected content")
+	assert.Len(t, mp.published, 1, "Only valid content should be published")
+}
+
+func TestPublishAllContentInvalid(t *testing.T) {
+	mp := &MockPublishService{}
+	h := NewHttpHandler(mp, nil, nil, nil)
+	body := `[{"uuid": "foo", "identifiers": [{"authority": "http://api.ft.com/system/FTCOM-METHODE"}]}]`
+
+	w := httptest.NewRecorder()
+	h.Publish(w, httptest.NewRequest("POST", "/metadata/publish", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Unexpected status code")
+	assert.Empty(t, mp.published, "Invalid content should not be published")
+}
+
+func TestPublishRequestTooLarge(t *testing.T) {
+	mp := &MockPublishService{}
+	h := NewHttpHandler(mp, nil, nil, nil)
+	body := "[" + strings.Repeat(" ", maxPublishRequestSize) + "]"
+
+	w := httptest.NewRecorder()
+	h.Publish(w, httptest.NewRequest("POST", "/metadata/publish", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "Unexpected status code")
+	assert.Empty(t, mp.published, "Nothing should be published for a too large request")
+}
+
+func TestPublishRequestAtSizeLimit(t *testing.T) {
+	mp := &MockPublishService{}
+	h := NewHttpHandler(mp, nil, nil, nil)
+	body := "[" + strings.Repeat(" ", maxPublishRequestSize-2) + "]"
+
+	w := httptest.NewRecorder()
+	h.Publish(w, httptest.NewRequest("POST", "/metadata/publish", strings.NewReader(body)))
+
+	assert.NotEqual(t, http.StatusRequestEntityTooLarge, w.Code, "A request of exactly the limit should be read")
+}
+
+func TestPublishResolvesPlainUUIDs(t *testing.T) {
+	mp := &MockPublishService{}
+	cs := &MockContentService{
+		mockGetContentByUUIDs: func(uuids []string) ([]Content, error) {
+			assert.Equal(t, []string{testContent.UUID, "0cd42702-f789-11e6-9516-2d969e0d3b66"}, uuids, "Unexpected UUIDs looked up")
+			return []Content{testContent}, nil
+		},
+	}
+	h := NewHttpHandler(mp, nil, cs, nil)
+	body := `["0cd42702-f789-11e6-9516-2d969e0d3b65", "0cd42702-f789-11e6-9516-2d969e0d3b66", "foo"]`
+
+	w := httptest.NewRecorder()
+	h.Publish(w, httptest.NewRequest("POST", "/metadata/publish", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusOK, w.Code, "Unexpected status code")
+	var report PublishReport
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&report), "Failed to decode publish report")
+	assert.Equal(t, 1, report.Accepted, "Unexpected number of accepted contents")
+	assert.Len(t, report.Rejected, 2, "Unexpected number of rejected contents")
+	assert.Equal(t, 1, report.Rejected[0].Index, "Content missing from the store should be rejected")
+	assert.Equal(t, 2, report.Rejected[1].Index, "Invalid UUID should be rejected")
+	assert.Equal(t, []Content{testContent}, mp.published, "Resolved content should be published")
+}
+
+func TestPublishDuplicateUUIDs(t *testing.T) {
+	mp := &MockPublishService{}
+	cs := &MockContentService{
+		mockGetContentByUUIDs: func(uuids []string) ([]Content, error) {
+			assert.Equal(t, []string{"0cd42702-f789-11e6-9516-2d969e0d3b66", testContent.UUID}, uuids, "Every UUID should be looked up once")
+			return []Content{testContent}, nil
+		},
+	}
+	h := NewHttpHandler(mp, nil, cs, nil)
+	body := `["0cd42702-f789-11e6-9516-2d969e0d3b66", "0cd42702-f789-11e6-9516-2d969e0d3b65", "0cd42702-f789-11e6-9516-2d969e0d3b66"]`
+
+	w := httptest.NewRecorder()
+	h.Publish(w, httptest.NewRequest("POST", "/metadata/publish", strings.NewReader(body)))
+
+	var report PublishReport
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&report), "Failed to decode publish report")
+	assert.Len(t, report.Rejected, 2, "Every occurrence of the missing content should be rejected")
+	assert.Equal(t, 0, report.Rejected[0].Index, "Unexpected index of the first occurrence")
+	assert.Equal(t, 2, report.Rejected[1].Index, "Unexpected index of the second occurrence")
+	assert.Equal(t, []Content{testContent}, mp.published, "Resolved content should be published")
+}
+
+func TestPublishContentStoreNotAvailable(t *testing.T) {
+	mp := &MockPublishService{}
+	cs := &MockContentService{
+		mockGetContentByUUIDs: func(uuids []string) ([]Content, error) {
+			return nil, errors.New("no reachable servers")
+		},
+	}
+	h := NewHttpHandler(mp, nil, cs, nil)
+
+	w := httptest.NewRecorder()
+	h.Publish(w, httptest.NewRequest("POST", "/metadata/publish", strings.NewReader(`["0cd42702-f789-11e6-9516-2d969e0d3b65"]`)))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "Unexpected status code")
+	assert.Empty(t, mp.published, "Nothing should be published when content cannot be looked up")
+}
+
+func TestStartBackfillDefaultsMaxCountDeviation(t *testing.T) {
+	mp := &V1MetadataPublishService{
+		cs: &MockContentService{
+			mockCountContent: func(source string) (int, error) {
+				return 950, nil
+			},
+			mockGetContent: func(source string, stop <-chan struct{}, errCh chan error) chan Content {
+				contentCh := make(chan Content)
+				close(contentCh)
+				return contentCh
+			},
+		},
+		limits:   newRateLimiter(RateLimits{BatchSize: 10}),
+		failures: newFailureBroker(),
+	}
+	h := NewHttpHandler(mp, NewBackfillManager(mp), nil, nil)
+	body := `{"source": "BLOGS", "preCount": true, "expectedCount": 1000}`
+
+	w := httptest.NewRecorder()
+	h.StartBackfill(w, httptest.NewRequest("POST", "/backfill/start", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusAccepted, w.Code, "A count within the default deviation should be accepted")
+	var status BackfillStatus
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&status), "Failed to decode backfill status")
+	assert.Equal(t, DefaultMaxCountDeviation, status.Options.MaxCountDeviation, "Unexpected maximum count deviation")
+}
@@ -0,0 +1,116 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	OutcomePublished  = "published"
+	OutcomeNoMetadata = "no_metadata"
+	OutcomeFailed     = "failed"
+)
+
+var attemptsBucket = []byte("attempts")
+
+type LedgerEntry struct {
+	UUID         string    `json:"uuid"`
+	Source       string    `json:"source,omitempty"`
+	RunID        string    `json:"runId,omitempty"`
+	TID          string    `json:"tid,omitempty"`
+	MetadataHash string    `json:"metadataHash,omitempty"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+	ErrorKind    string    `json:"errorKind,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// Ledger keeps a record of every publish attempt for each content item
+type Ledger interface {
+	Record(entry LedgerEntry) error
+	History(uuid string) ([]LedgerEntry, error)
+}
+
+type BoltLedger struct {
+	db *bolt.DB
+}
+
+func OpenBoltLedger(path string, readOnly bool) (*BoltLedger, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, err
+	}
+	if !readOnly {
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(attemptsBucket)
+			return err
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &BoltLedger{db: db}, nil
+}
+
+func (l *BoltLedger) Close() error {
+	return l.db.Close()
+}
+
+// Record stores the attempt in a bucket per UUID, keyed by a sequence so that the history is kept in order
+func (l *BoltLedger) Record(entry LedgerEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return l.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(attemptsBucket).CreateBucketIfNotExists([]byte(entry.UUID))
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return b.Put(key, value)
+	})
+}
+
+func (l *BoltLedger) History(uuid string) ([]LedgerEntry, error) {
+	history := []LedgerEntry{}
+	err := l.db.View(func(tx *bolt.Tx) error {
+		attempts := tx.Bucket(attemptsBucket)
+		if attempts == nil {
+			return nil
+		}
+		b := attempts.Bucket([]byte(uuid))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var entry LedgerEntry
+			err := json.Unmarshal(v, &entry)
+			if err != nil {
+				return err
+			}
+			history = append(history, entry)
+			return nil
+		})
+	})
+	return history, err
+}
+
+func metadataHash(metadata []byte) string {
+	if len(metadata) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(metadata)
+	return hex.EncodeToString(sum[:])
+}
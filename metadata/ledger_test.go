@@ -0,0 +1,104 @@
+package metadata
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLedger(t *testing.T) (*BoltLedger, func()) {
+	dir, err := ioutil.TempDir("", "ledger")
+	assert.NoError(t, err, "Failed to create ledger directory")
+	l, err := OpenBoltLedger(filepath.Join(dir, "ledger.db"), false)
+	assert.NoError(t, err, "Failed to open ledger")
+	return l, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLedgerHistoryIsKeptInOrder(t *testing.T) {
+	l, cleanup := newTestLedger(t)
+	defer cleanup()
+
+	assert.NoError(t, l.Record(LedgerEntry{UUID: testContent.UUID, RunID: "run1", Outcome: OutcomeFailed}), "Failed to record attempt")
+	assert.NoError(t, l.Record(LedgerEntry{UUID: "4fad74e8-056c-11e7-ace0-1ce02ef0def9", RunID: "run1", Outcome: OutcomePublished}), "Failed to record attempt")
+	assert.NoError(t, l.Record(LedgerEntry{UUID: testContent.UUID, RunID: "run2", Outcome: OutcomePublished, TID: "tid_testtid"}), "Failed to record attempt")
+
+	history, err := l.History(testContent.UUID)
+	assert.NoError(t, err, "Failed to read history")
+	assert.Len(t, history, 2, "Unexpected number of attempts")
+	assert.Equal(t, "run1", history[0].RunID, "Attempts should be returned in order")
+	assert.Equal(t, OutcomeFailed, history[0].Outcome, "Unexpected outcome")
+	assert.Equal(t, "tid_testtid", history[1].TID, "Unexpected tid")
+
+	history, err = l.History("7560aca3-986c-487b-8f9f-6b865872096f")
+	assert.NoError(t, err, "Failed to read history")
+	assert.Empty(t, history, "Unknown content should have no history")
+}
+
+func TestSendMetadataJobRecordsAttempts(t *testing.T) {
+	l, cleanup := newTestLedger(t)
+	defer cleanup()
+
+	ps := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Request-Id", "tid_testtid")
+	}))
+	defer ps.Close()
+
+	mps := V1MetadataPublishService{
+		publishing: &Cluster{address: ps.URL + "/__cms-metadata-notifier/notify"},
+		mr: &MockMetadataReadService{
+			mockReadByUUID: func(content Content) ([]byte, error) {
+				return getMetadata()
+			},
+		},
+		limits:   newRateLimiter(RateLimits{BatchSize: 10}),
+		failures: newFailureBroker(),
+		ledger:   l,
+		client:   http.DefaultClient,
+	}
+
+	doneCh := make(chan bool)
+	go mps.sendMetadataJob([]Content{testContent}, &jobStats{runID: "run1"}, make(chan error), doneCh)
+	<-doneCh
+
+	history, err := l.History(testContent.UUID)
+	assert.NoError(t, err, "Failed to read history")
+	assert.Len(t, history, 1, "Unexpected number of attempts")
+	m, _ := getMetadata()
+	assert.Equal(t, LedgerEntry{
+		UUID:         testContent.UUID,
+		Source:       "METHODE",
+		RunID:        "run1",
+		TID:          "tid_testtid",
+		MetadataHash: metadataHash(m),
+		Outcome:      OutcomePublished,
+		Time:         history[0].Time,
+	}, history[0], "Unexpected recorded attempt")
+}
+
+func TestHistoryEndpoint(t *testing.T) {
+	l, cleanup := newTestLedger(t)
+	defer cleanup()
+	assert.NoError(t, l.Record(LedgerEntry{UUID: testContent.UUID, Outcome: OutcomePublished}), "Failed to record attempt")
+
+	h := NewHttpHandler(&MockPublishService{}, nil, nil, l)
+	r := mux.NewRouter()
+	r.HandleFunc("/history/{uuid}", h.History)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/history/"+testContent.UUID, nil))
+	assert.Equal(t, http.StatusOK, w.Code, "Unexpected status code")
+	assert.Contains(t, w.Body.String(), `"outcome":"published"`, "Expecting the recorded attempt")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/history/foo", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Unexpected status code for an invalid UUID")
+}
@@ -0,0 +1,42 @@
+package metadata
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logrus.StandardLogger()
+
+const (
+	runIDField      = "run_id"
+	uuidField       = "uuid"
+	tidField        = "tid"
+	sourceField     = "source"
+	stageField      = "stage"
+	statusCodeField = "status_code"
+	durationField   = "duration_ms"
+	errorKindField  = "error_kind"
+
+	stageScan     = "scan"
+	stageRead     = "read"
+	stagePublish  = "publish"
+	stageBackfill = "backfill"
+	stageAPI      = "api"
+)
+
+// contentLog returns a log entry with the fields identifying a content item at a stage of a run
+func contentLog(runID string, content Content, stage string) *logrus.Entry {
+	fields := logrus.Fields{uuidField: content.UUID, stageField: stage}
+	if runID != "" {
+		fields[runIDField] = runID
+	}
+	if source, ok := content.getSource(); ok {
+		fields[sourceField] = source
+	}
+	return log.WithFields(fields)
+}
+
+func durationMillis(start time.Time) int64 {
+	return int64(time.Since(start) / time.Millisecond)
+}
@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentLogFields(t *testing.T) {
+	entry := contentLog("run1", testContent, stageRead)
+
+	assert.Equal(t, "run1", entry.Data[runIDField], "Unexpected run ID field")
+	assert.Equal(t, testContent.UUID, entry.Data[uuidField], "Unexpected uuid field")
+	assert.Equal(t, "METHODE", entry.Data[sourceField], "Unexpected source field")
+	assert.Equal(t, stageRead, entry.Data[stageField], "Unexpected stage field")
+}
+
+func TestPublishMetadataForUUIDLogsOutcome(t *testing.T) {
+	hook := test.NewLocal(log)
+	defer hook.Reset()
+
+	ps := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Request-Id", "tid_testtid")
+	}))
+	defer ps.Close()
+
+	mps := V1MetadataPublishService{
+		publishing: &Cluster{address: ps.URL + "/__cms-metadata-notifier/notify"},
+		client:     http.DefaultClient,
+	}
+	_, err := mps.publishMetadataForUUID("run1", testContent, []byte("<metadata/>"))
+	assert.NoError(t, err, "Failed to publish metadata")
+
+	entry := hook.LastEntry()
+	assert.NotNil(t, entry, "Expecting the publish to be logged")
+	assert.Equal(t, logrus.InfoLevel, entry.Level, "Unexpected log level")
+	assert.Equal(t, "run1", entry.Data[runIDField], "Unexpected run ID field")
+	assert.Equal(t, testContent.UUID, entry.Data[uuidField], "Unexpected uuid field")
+	assert.Equal(t, "tid_testtid", entry.Data[tidField], "Unexpected tid field")
+	assert.Equal(t, stagePublish, entry.Data[stageField], "Unexpected stage field")
+	assert.Equal(t, http.StatusOK, entry.Data[statusCodeField], "Unexpected status code field")
+	assert.Contains(t, entry.Data, durationField, "Expecting duration field")
+}
+
+func TestReadByUUIDLogsRunID(t *testing.T) {
+	hook := test.NewLocal(log)
+	defer hook.Reset()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	reader, err := NewV1MetadataReadService(&Cluster{address: ts.URL + BindingServiceURL})
+	assert.NoError(t, err, "Failed to initialise metadata reader")
+
+	_, err = reader.ReadByUUID(testContent, ReadRun{ID: "run1"})
+	assert.Error(t, err, "Expecting the read to fail")
+
+	entry := hook.LastEntry()
+	assert.NotNil(t, entry, "Expecting the read to be logged")
+	assert.Equal(t, "run1", entry.Data[runIDField], "Unexpected run ID field")
+	assert.Equal(t, stageRead, entry.Data[stageField], "Unexpected stage field")
+}
@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CachedReadService keeps the responses of the binding service on disk, so that a run repeated
+// within the TTL does not read the same metadata again; no metadata is cached as an empty file
+type CachedReadService struct {
+	next   ReadService
+	dir    string
+	ttl    time.Duration
+	bypass bool
+	schema *MetadataSchema
+}
+
+// NewCachedReadService caches the responses of next in dir; with bypass the cache is not read
+// but still refreshed with the new responses
+func NewCachedReadService(next ReadService, dir string, ttl time.Duration, bypass bool) (*CachedReadService, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create metadata cache directory: %s", err)
+	}
+	return &CachedReadService{next: next, dir: dir, ttl: ttl, bypass: bypass}, nil
+}
+
+// SetSchema makes cached metadata not following the schema be read again, as it may have been cached
+// before the schema changed; responses of next are expected to be validated by next
+func (c *CachedReadService) SetSchema(schema *MetadataSchema) {
+	c.schema = schema
+}
+
+func (c *CachedReadService) ReadByUUID(content Content, run ReadRun) ([]byte, error) {
+	source, ok := content.getSource()
+	if !ok {
+		return c.next.ReadByUUID(content, run)
+	}
+	path := c.path(source, content.UUID)
+
+	if c.bypass {
+		metadataCacheRequests.WithLabelValues("bypass").Inc()
+	} else if metadata, ok := c.get(content, run, path); ok {
+		if len(metadata) == 0 {
+			return nil, ErrNoMetadata
+		}
+		return metadata, nil
+	}
+
+	metadata, err := c.next.ReadByUUID(content, run)
+	if err != nil && err != ErrNoMetadata {
+		return metadata, err
+	}
+	putErr := c.put(path, metadata)
+	if putErr != nil {
+		contentLog(run.ID, content, stageRead).WithError(putErr).Warning("Caching metadata failed")
+	}
+	return metadata, err
+}
+
+// path spreads the entries over subdirectories named after the first characters of the hash of the key
+func (c *CachedReadService) path(source string, uuid string) string {
+	sum := sha256.Sum256([]byte(source + "/" + uuid))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+func (c *CachedReadService) get(content Content, run ReadRun, path string) ([]byte, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			contentLog(run.ID, content, stageRead).WithError(err).Warning("Reading metadata cache failed")
+		}
+		metadataCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	if time.Since(info.ModTime()) > c.ttl {
+		metadataCacheRequests.WithLabelValues("expired").Inc()
+		return nil, false
+	}
+	metadata, err := ioutil.ReadFile(path)
+	if err != nil {
+		contentLog(run.ID, content, stageRead).WithError(err).Warning("Reading metadata cache failed")
+		metadataCacheRequests.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	if len(metadata) > 0 {
+		err = validateMetadata(content, metadata, c.schema)
+		if err != nil {
+			contentLog(run.ID, content, stageRead).WithError(err).Info("Cached metadata is not valid anymore")
+			metadataCacheRequests.WithLabelValues("invalid").Inc()
+			return nil, false
+		}
+	}
+	metadataCacheRequests.WithLabelValues("hit").Inc()
+	contentLog(run.ID, content, stageRead).Debug("Metadata read from cache")
+	return metadata, true
+}
+
+// put writes the entry to a temporary file first, so that a concurrent or interrupted run never reads a partial entry
+func (c *CachedReadService) put(path string, metadata []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(metadata)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
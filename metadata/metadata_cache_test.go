@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCache(t *testing.T, response func() ([]byte, error), ttl time.Duration, bypass bool) (*CachedReadService, *int, func()) {
+	dir, err := ioutil.TempDir("", "metadata-cache")
+	assert.NoError(t, err, "Failed to create cache directory")
+	reads := 0
+	next := &MockMetadataReadService{
+		mockReadByUUID: func(content Content) ([]byte, error) {
+			reads++
+			return response()
+		},
+	}
+	c, err := NewCachedReadService(next, dir, ttl, bypass)
+	assert.NoError(t, err, "Failed to create cache")
+	return c, &reads, func() { os.RemoveAll(dir) }
+}
+
+func TestCachedReadServiceHit(t *testing.T) {
+	c, reads, cleanup := newTestCache(t, getMetadata, time.Hour, false)
+	defer cleanup()
+	expected, _ := getMetadata()
+
+	for i := 0; i < 2; i++ {
+		metadata, err := c.ReadByUUID(testContent, ReadRun{})
+		assert.NoError(t, err, "Failed to read metadata")
+		assert.Equal(t, expected, metadata, "Actual metadata differs from expected metadata")
+	}
+	assert.Equal(t, 1, *reads, "Cached metadata should not be read again")
+}
+
+func TestCachedReadServiceNoMetadata(t *testing.T) {
+	c, reads, cleanup := newTestCache(t, func() ([]byte, error) { return nil, ErrNoMetadata }, time.Hour, false)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		metadata, err := c.ReadByUUID(testContent, ReadRun{})
+		assert.Equal(t, ErrNoMetadata, err, "Expecting no metadata")
+		assert.Empty(t, metadata, "Expecting no metadata")
+	}
+	assert.Equal(t, 1, *reads, "Missing metadata should be cached too")
+}
+
+func TestCachedReadServiceExpired(t *testing.T) {
+	c, reads, cleanup := newTestCache(t, getMetadata, time.Hour, false)
+	defer cleanup()
+
+	_, err := c.ReadByUUID(testContent, ReadRun{})
+	assert.NoError(t, err, "Failed to read metadata")
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(c.path("METHODE", testContent.UUID), old, old), "Failed to age cache entry")
+
+	_, err = c.ReadByUUID(testContent, ReadRun{})
+	assert.NoError(t, err, "Failed to read metadata")
+	assert.Equal(t, 2, *reads, "Expired metadata should be read again")
+}
+
+func TestCachedReadServiceBypass(t *testing.T) {
+	c, reads, cleanup := newTestCache(t, getMetadata, time.Hour, true)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		_, err := c.ReadByUUID(testContent, ReadRun{})
+		assert.NoError(t, err, "Failed to read metadata")
+	}
+	assert.Equal(t, 2, *reads, "Cache should be bypassed")
+	_, err := os.Stat(c.path("METHODE", testContent.UUID))
+	assert.NoError(t, err, "Bypassed cache should still be refreshed")
+}
+
+func TestCachedReadServiceDoesNotCacheErrors(t *testing.T) {
+	c, reads, cleanup := newTestCache(t, func() ([]byte, error) { return nil, errors.New("Binding service unavailable") }, time.Hour, false)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		_, err := c.ReadByUUID(testContent, ReadRun{})
+		assert.Error(t, err, "Expecting error from the binding service")
+	}
+	assert.Equal(t, 2, *reads, "Failures should not be cached")
+}
+
+func TestCachedMetadataIsValidatedAgainstCurrentSchema(t *testing.T) {
+	h := newHarness(t, testContents(1, methodeAuthority, 0), RateLimits{BatchSize: 100})
+	defer h.Close()
+	dir, err := ioutil.TempDir("", "metadata-cache")
+	assert.NoError(t, err, "Failed to create cache directory")
+	defer os.RemoveAll(dir)
+	reader := h.mp.mr.(*V1MetadataReadService)
+	c, err := NewCachedReadService(reader, dir, time.Hour, false)
+	assert.NoError(t, err, "Failed to create cache")
+	h.mp.mr = c
+
+	err = h.mp.PublishBackfill(NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 100}))
+	assert.NoError(t, err, "Backfill should finish without error")
+	assert.Len(t, h.notifier.received(), 1, "Metadata should be published without a schema")
+
+	schema := &MetadataSchema{Taxonomies: []string{"Topics"}}
+	reader.SetSchema(schema)
+	c.SetSchema(schema)
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 100})
+	err = h.mp.PublishBackfill(b)
+	assert.NoError(t, err, "Backfill should finish without error")
+	assert.Len(t, h.bindingService.requested(), 2, "Cached metadata breaking the schema should be read again")
+	assert.Len(t, h.notifier.received(), 1, "Metadata breaking the schema should not be published")
+	assert.Equal(t, map[string]int64{ErrorInvalidMetadata: 1}, b.Status().FailedBy, "Unexpected failures by kind")
+}
@@ -7,17 +7,15 @@ import (
 	"net/http"
 	"time"
 
-	"sync"
-
-	"github.com/gosuri/uilive"
-	"github.com/op/go-logging"
+	"github.com/sirupsen/logrus"
 )
 
-var log = logging.MustGetLogger("v1-metadata-publisher")
-
 type PublishService interface {
 	Publish() error
 	SendMetadataJob(contents []Content, errorsCh chan error, doneCh chan bool)
+	RateLimits() RateLimits
+	SetRateLimits(limits RateLimits) error
+	SubscribeFailures() (<-chan FailureEvent, func())
 }
 
 type V1MetadataPublishService struct {
@@ -25,151 +23,250 @@ type V1MetadataPublishService struct {
 	publishing *Cluster
 	mr         ReadService
 	source     string
-	batchSize  int
+	limits     *rateLimiter
+	failures   *failureBroker
+	ledger     Ledger
+	breaker    *circuitBreaker
 	client     *http.Client
+	// payloadFormat is PayloadXML or PayloadAnnotations
+	payloadFormat string
 }
 
-func NewV1MetadataPublishService(contentService ContentService, publishing *Cluster, mr ReadService, source string, batchSize int) *V1MetadataPublishService {
+func NewV1MetadataPublishService(contentService ContentService, publishing *Cluster, mr ReadService, source string, limits RateLimits) (*V1MetadataPublishService, error) {
+	err := limits.validate()
+	if err != nil {
+		return nil, err
+	}
+	t, err := publishing.transport(AuthBasic, &(*transport))
+	if err != nil {
+		return nil, err
+	}
 	return &V1MetadataPublishService{
-		cs:         contentService,
-		publishing: publishing,
-		mr:         mr,
-		source:     source,
-		batchSize:  batchSize,
-		client:     &http.Client{Transport: &(*transport)},
+		cs:            contentService,
+		publishing:    publishing,
+		mr:            mr,
+		source:        source,
+		limits:        newRateLimiter(limits),
+		failures:      newFailureBroker(),
+		client:        &http.Client{Transport: t},
+		payloadFormat: PayloadXML,
+	}, nil
+}
+
+// SetLedger makes the service record every publish attempt in the given ledger
+func (mp *V1MetadataPublishService) SetLedger(ledger Ledger) {
+	mp.ledger = ledger
+}
+
+// InjectFaults makes the requests to the notifier fail as configured, for resilience testing
+func (mp *V1MetadataPublishService) InjectFaults(config FaultConfig) {
+	mp.client.Transport = NewFaultTransport(mp.client.Transport, config)
+}
+
+// SetPayloadFormat selects what is sent to the notifier: PayloadXML or PayloadAnnotations
+func (mp *V1MetadataPublishService) SetPayloadFormat(format string) error {
+	if format != PayloadXML && format != PayloadAnnotations {
+		return fmt.Errorf("Invalid payload format %q, expecting %s or %s", format, PayloadXML, PayloadAnnotations)
 	}
+	mp.payloadFormat = format
+	return nil
+}
+
+// SetCircuitBreaker pauses the reads for the cooldown once the binding service failed threshold times in a row
+func (mp *V1MetadataPublishService) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	mp.breaker = newCircuitBreaker(threshold, cooldown)
+}
+
+func (mp *V1MetadataPublishService) RateLimits() RateLimits {
+	return mp.limits.get()
+}
+
+// SetRateLimits changes the rates and concurrency of the stages, taking effect immediately apart from the queue size
+func (mp *V1MetadataPublishService) SetRateLimits(limits RateLimits) error {
+	err := mp.limits.set(limits)
+	if err != nil {
+		return err
+	}
+	log.WithFields(logrus.Fields{
+		"batch_size":          limits.BatchSize,
+		"max_concurrency":     limits.MaxConcurrency,
+		"publish_rate":        limits.PublishRate,
+		"publish_concurrency": limits.PublishConcurrency,
+	}).Info("Rate limits changed")
+	return nil
+}
+
+// SubscribeFailures returns the failures of all backfills and jobs from now on, and a function to unsubscribe
+func (mp *V1MetadataPublishService) SubscribeFailures() (<-chan FailureEvent, func()) {
+	return mp.failures.subscribe()
 }
 
 func (mp *V1MetadataPublishService) Publish() error {
-	publishErr := make(chan error)
-	defer close(publishErr)
-	done := make(chan bool)
-	defer close(done)
-	writer := uilive.New()
-	writer.Start()
-
-	startTime := time.Now()
-	contentCh := mp.cs.GetContent(mp.source)
-	batch := []Content{}
+	return mp.PublishBackfill(NewBackfill(PublishOptions{Source: mp.source, BatchSize: mp.limits.get().BatchSize}))
+}
+
+func (mp *V1MetadataPublishService) PublishBackfill(b *Backfill) error {
+	reporter := NewProgressReporter(b.Status)
+	position := newWatermark(b.options.Skip, b.setPosition)
+	p := mp.startPipeline(&b.jobStats, nil, b.cancelled, position.complete)
+
+	contentErr := make(chan error, 1)
+	contentCh := mp.cs.GetContent(b.options.Source, b.cancelled, contentErr)
 	progress := 0
+	sinceReport := 0
+	sinceSleep := 0
 
-	for {
-		content, ok := <-contentCh
-		if !ok {
-			if len(batch) > 0 {
-				go mp.SendMetadataJob(batch, publishErr, done)
-				wait(publishErr, done)
-			}
-			fmt.Fprintf(writer, "\nFinished: %d contents published for source %s\n", progress, mp.source)
-			writer.Stop()
-			return nil
+	for content := range contentCh {
+		if b.isCancelled() {
+			//keep draining until the content service stops
+			continue
 		}
 		progress++
-		batch = append(batch, content)
-		if progress%mp.batchSize == 0 {
-			fmt.Fprintf(writer, "%d content items published in %.0f minutes \n", progress, time.Since(startTime).Minutes())
-			go mp.SendMetadataJob(batch, publishErr, done)
-			wait(publishErr, done)
-			batch = []Content{}
-
-			if progress%50000 == 0 {
-				time.Sleep(5 * time.Minute)
-			}
+		if progress <= b.options.Skip {
+			b.setPosition(progress)
+			continue
+		}
+		p.submit(progress, content)
+		sinceSleep++
+		sinceReport++
+		if sinceReport >= mp.limits.get().BatchSize {
+			sinceReport = 0
+			reporter.Report(b.Status())
+		}
+
+		if !b.waitWhilePaused() {
+			continue
 		}
+		if sinceSleep >= 50000 {
+			sinceSleep = 0
+			b.sleep(5 * time.Minute)
+		}
+	}
+	p.close()
+
+	var err error
+	select {
+	case err = <-contentErr:
+	default:
 	}
+	b.finish(err)
+	reporter.Finish(b.Status())
+	return err
 }
 
 func (mp *V1MetadataPublishService) SendMetadataJob(contents []Content, errorsCh chan error, doneCh chan bool) {
-	var wg sync.WaitGroup
-	wg.Add(len(contents))
-	rate := time.Second / time.Duration(len(contents))
-	throttle := time.Tick(rate)
+	mp.sendMetadataJob(contents, &jobStats{}, errorsCh, doneCh)
+}
 
+// sendMetadataJob reads and publishes the metadata of the contents, sending failures to errorsCh, and signals doneCh when finished
+func (mp *V1MetadataPublishService) sendMetadataJob(contents []Content, stats *jobStats, errorsCh chan error, doneCh chan bool) {
+	p := mp.startPipeline(stats, errorsCh, nil, nil)
 	for i, content := range contents {
-		<-throttle
-		go func(content Content, i int) {
-			defer wg.Done()
-			value, err := mp.mr.ReadByUUID(content)
-			if err != nil {
-				errorsCh <- err
-				return
-			}
-			if len(value) == 0 {
-				return
-			}
-			err = mp.publishMetadataForUUID(content, value)
-			if err != nil {
-				j, _ := json.Marshal(content)
-				log.Errorf("Metadata publish for content=[%s] failed because: [%s]", j, err)
-				errorsCh <- err
-				return
-			}
-		}(content, i)
-	}
-	wg.Wait()
+		p.submit(i+1, content)
+	}
+	p.close()
 	doneCh <- true
 }
 
-func (mp *V1MetadataPublishService) publishMetadataForUUID(content Content, metadata []byte) error {
-	body, err := getPayload(content.UUID, metadata)
+func (mp *V1MetadataPublishService) recordFailure(stats *jobStats, content Content, err error) {
+	kind := errorKind(err)
+	stats.fail(kind)
+	mp.failures.publish(FailureEvent{RunID: stats.runID, UUID: content.UUID, Error: err.Error(), Kind: kind, Time: time.Now()})
+}
+
+// recordAttempt adds the outcome of reading and publishing the metadata of a content item to the ledger, if there is one
+func (mp *V1MetadataPublishService) recordAttempt(runID string, content Content, tid string, metadata []byte, err error) {
+	if mp.ledger == nil {
+		return
+	}
+	source, _ := content.getSource()
+	entry := LedgerEntry{
+		UUID:         content.UUID,
+		Source:       source,
+		RunID:        runID,
+		TID:          tid,
+		MetadataHash: metadataHash(metadata),
+		Outcome:      OutcomePublished,
+		Time:         time.Now(),
+	}
+	if len(metadata) == 0 {
+		entry.Outcome = OutcomeNoMetadata
+	}
 	if err != nil {
-		return err
+		entry.Outcome = OutcomeFailed
+		entry.Error = err.Error()
+		entry.ErrorKind = errorKind(err)
+	}
+
+	recordErr := mp.ledger.Record(entry)
+	if recordErr != nil {
+		contentLog(runID, content, stagePublish).WithError(recordErr).Error("Recording publish attempt failed")
 	}
+}
 
-	req, err := getPublishRequest(body, mp.publishing.GetAddress(), mp.publishing.GetUsername(), mp.publishing.GetPassword())
+// publishMetadataForUUID sends the metadata to the notifier and returns the transaction ID of the publish
+func (mp *V1MetadataPublishService) publishMetadataForUUID(runID string, content Content, metadata []byte) (string, error) {
+	logger := contentLog(runID, content, stagePublish)
+	body, err := getPayload(mp.payloadFormat, content.UUID, metadata)
 	if err != nil {
-		return err
+		logger.WithError(err).Error("Building metadata payload failed")
+		return "", err
 	}
 
+	req, err := getPublishRequest(body, mp.publishing.GetAddress())
+	if err != nil {
+		logger.WithError(err).Error("Building publish request failed")
+		return "", err
+	}
+
+	start := time.Now()
 	resp, err := mp.client.Do(req)
+	status := statusLabel(resp)
+	notifierPublishes.WithLabelValues(status).Inc()
+	notifierLatency.WithLabelValues(status).Observe(time.Since(start).Seconds())
+	logger = logger.WithField(durationField, durationMillis(start))
 	if err != nil {
-		return fmt.Errorf("Publishing of metadata failed: [%s]", err)
+		publishErr := upstreamError(stagePublish, "Publishing of metadata failed: [%s]", err)
+		logger.WithError(publishErr).WithField(errorKindField, publishErr.Kind).Error("Metadata publish failed")
+		return "", publishErr
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Publishing of metadata failed with status code %d", resp.StatusCode)
-	}
 
 	tid := resp.Header.Get("X-Request-Id")
-	log.Infof("Metadata published for content=[%s] having tid=[%s]", content.UUID, tid)
-	return nil
+	logger = logger.WithFields(logrus.Fields{statusCodeField: resp.StatusCode, tidField: tid})
+	if resp.StatusCode != http.StatusOK {
+		publishErr := statusError(stagePublish, resp.StatusCode, "notifier")
+		logger.WithError(publishErr).WithField(errorKindField, publishErr.Kind).Error("Metadata publish failed")
+		return tid, publishErr
+	}
+	logger.Info("Metadata published")
+	return tid, nil
 }
 
-func getPayload(UUID string, metadata []byte) ([]byte, error) {
+// getPayload builds the message for the notifier, with either the metadata as it is or the annotations transformed from it
+func getPayload(format string, UUID string, metadata []byte) ([]byte, error) {
 	message := map[string]interface{}{
 		"uuid":         UUID,
 		"lastModified": time.Now().String(),
-		"value":        metadata,
+	}
+	if format == PayloadAnnotations {
+		annotations, err := TransformMetadata(metadata)
+		if err != nil {
+			return nil, err
+		}
+		message["annotations"] = annotations
+	} else {
+		message["value"] = metadata
 	}
 	return json.Marshal(message)
 }
 
-func getPublishRequest(body []byte, url string, username string, password string) (*http.Request, error) {
+func getPublishRequest(body []byte, url string) (*http.Request, error) {
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
-	req.SetBasicAuth(username, password)
 	req.Header.Add("X-Origin-System-Id", "binding-service")
 	req.Header.Add("Content-Type", "application/json")
 	return req, nil
 }
-
-func wait(publishErr chan error, done chan bool) {
-	for {
-		select {
-		case err := <-publishErr:
-			checkError(err, "metadata publishing")
-		case <-done:
-			return
-		}
-	}
-}
-
-func checkError(err error, operation string) bool {
-	if err != nil {
-		log.Errorf("Error occured while %s: %s", operation, err)
-		return true
-	}
-	return false
-}
@@ -14,19 +14,29 @@ type MockMetadataReadService struct {
 	mockReadByUUID func(content Content) ([]byte, error)
 }
 
-func (mr *MockMetadataReadService) ReadByUUID(content Content) ([]byte, error) {
+func (mr *MockMetadataReadService) ReadByUUID(content Content, run ReadRun) ([]byte, error) {
 	return mr.mockReadByUUID(content)
 }
 
 type MockContentService struct {
-	mockGetContent func(source string, errCh chan error) chan Content
+	mockGetContent        func(source string, stop <-chan struct{}, errCh chan error) chan Content
+	mockGetContentByUUIDs func(uuids []string) ([]Content, error)
+	mockCountContent      func(source string) (int, error)
 }
 
-func (cs *MockContentService) GetContent(source string, errCh chan error) chan Content {
-	return cs.mockGetContent(source, errCh)
+func (cs *MockContentService) GetContent(source string, stop <-chan struct{}, errCh chan error) chan Content {
+	return cs.mockGetContent(source, stop, errCh)
 
 }
 
+func (cs *MockContentService) GetContentByUUIDs(uuids []string) ([]Content, error) {
+	return cs.mockGetContentByUUIDs(uuids)
+}
+
+func (cs *MockContentService) CountContent(source string) (int, error) {
+	return cs.mockCountContent(source)
+}
+
 func TestPublishMetadataForUUIDSuccessfully(t *testing.T) {
 	ps := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "binding-service", r.Header.Get("X-Origin-System-Id"), "Invalid X-Origin-System-Id header value")
@@ -46,7 +56,7 @@ func TestPublishMetadataForUUIDSuccessfully(t *testing.T) {
 
 	cm, err := getMetadata()
 	assert.NoError(t, err, "Failed to read metadata")
-	err = mps.publishMetadataForUUID(testContent, cm)
+	_, err = mps.publishMetadataForUUID("", testContent, cm)
 	assert.NoError(t, err, "Failed to publish metadata")
 }
 
@@ -67,7 +77,7 @@ func TestPublishMetadataForUUIDUnsuccesfully(t *testing.T) {
 
 	mc, err := getMetadata()
 	assert.NoError(t, err, "Failed to read metadata")
-	err = mps.publishMetadataForUUID(testContent, mc)
+	_, err = mps.publishMetadataForUUID("", testContent, mc)
 	assert.Error(t, err, "Expected metadata publish will return an error")
 }
 
@@ -92,7 +102,9 @@ func TestSendMetadataJobSuccessfully(t *testing.T) {
 				return getMetadata()
 			},
 		},
-		client: http.DefaultClient,
+		limits:   newRateLimiter(RateLimits{BatchSize: 10}),
+		failures: newFailureBroker(),
+		client:   http.DefaultClient,
 	}
 
 	errorsCh := make(chan error)
@@ -133,7 +145,9 @@ func TestSendMetadataJobMetadataServiceNotAvailable(t *testing.T) {
 				return nil, fmt.Errorf("Cannot get metadata")
 			},
 		},
-		client: http.DefaultClient,
+		limits:   newRateLimiter(RateLimits{BatchSize: 10}),
+		failures: newFailureBroker(),
+		client:   http.DefaultClient,
 	}
 
 	errorsCh := make(chan error)
@@ -171,7 +185,9 @@ func TestSendMetadataJobPublishingClusterNotAvailable(t *testing.T) {
 				return nil, fmt.Errorf("Cannot get metadata")
 			},
 		},
-		client: http.DefaultClient,
+		limits:   newRateLimiter(RateLimits{BatchSize: 10}),
+		failures: newFailureBroker(),
+		client:   http.DefaultClient,
 	}
 
 	errorsCh := make(chan error)
@@ -202,7 +218,7 @@ func TestPublishSuccessful(t *testing.T) {
 
 	mps := V1MetadataPublishService{
 		cs: &MockContentService{
-			mockGetContent: func(source string, errCh chan error) chan Content {
+			mockGetContent: func(source string, stop <-chan struct{}, errCh chan error) chan Content {
 				contentCh := make(chan Content)
 				go func() {
 					defer close(contentCh)
@@ -223,9 +239,10 @@ func TestPublishSuccessful(t *testing.T) {
 				return m, nil
 			},
 		},
-		batchSize: 10,
-		source:    "METHODE",
-		client:    http.DefaultClient,
+		limits:   newRateLimiter(RateLimits{BatchSize: 10}),
+		failures: newFailureBroker(),
+		source:   "METHODE",
+		client:   http.DefaultClient,
 	}
 
 	err := mps.Publish()
@@ -242,16 +259,17 @@ func TestPublishUnsuccessfulDeliveryClusterNotAvailble(t *testing.T) {
 
 	mps := V1MetadataPublishService{
 		cs: &MockContentService{
-			mockGetContent: func(source string, errCh chan error) chan Content {
-				go func() {
-					errCh <- errors.New("Error getting content")
-				}()
-				return nil
+			mockGetContent: func(source string, stop <-chan struct{}, errCh chan error) chan Content {
+				contentCh := make(chan Content)
+				errCh <- errors.New("Error getting content")
+				close(contentCh)
+				return contentCh
 			},
 		},
-		batchSize: 10,
-		source:    "METHODE",
-		client:    http.DefaultClient,
+		limits:   newRateLimiter(RateLimits{BatchSize: 10}),
+		failures: newFailureBroker(),
+		source:   "METHODE",
+		client:   http.DefaultClient,
 	}
 
 	err := mps.Publish()
@@ -4,89 +4,229 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
+	"path"
+	"regexp"
 	"strings"
-
-	"github.com/bobziuchkovski/digest"
-	"github.com/pkg/errors"
-	"encoding/json"
+	"time"
 )
 
 const (
 	SourcePlaceholder = "{source}"
 	UUIDPlaceholder   = "{uuid}"
+	// AuthorityPlaceholder, SystemCodePlaceholder and IdentifierValuePlaceholder are replaced with the authority
+	// of the first identifier of the content, its last path segment (e.g. FT-LABS-WP-1-335) and its value
+	AuthorityPlaceholder       = "{authority}"
+	SystemCodePlaceholder      = "{systemCode}"
+	IdentifierValuePlaceholder = "{identifierValue}"
+
+	readTimeout = time.Minute
+	// maxRetryBackoff caps the exponential backoff between read retries
+	maxRetryBackoff = 5 * time.Minute
 )
 
 type ReadService interface {
-	ReadByUUID(content Content) ([]byte, error)
+	// ReadByUUID returns the metadata of the content, or ErrNoMetadata if there is none
+	ReadByUUID(content Content, run ReadRun) ([]byte, error)
+}
+
+// ReadRun is the run a read belongs to, identified in the logs of the read
+type ReadRun struct {
+	ID string
+	// Cancelled stops waiting to retry a read once the run is cancelled
+	Cancelled <-chan struct{}
 }
 
 type V1MetadataReadService struct {
-	client *http.Client
-	url    string
+	client     *http.Client
+	url        string
+	maxRetries int
+	backoff    time.Duration
+	schema     *MetadataSchema
+	// sourceURLs are the URL templates of the sources read from other endpoints than url
+	sourceURLs map[string]string
+}
+
+var placeholderRegexp = regexp.MustCompile(`\{[^{}]*\}`)
+
+// validateURLTemplate checks that the template only has known placeholders and identifies the content
+func validateURLTemplate(template string) error {
+	for _, p := range placeholderRegexp.FindAllString(template, -1) {
+		switch p {
+		case SourcePlaceholder, UUIDPlaceholder, AuthorityPlaceholder, SystemCodePlaceholder, IdentifierValuePlaceholder:
+		default:
+			return fmt.Errorf("Metadata URL %s has unknown placeholder %s", template, p)
+		}
+	}
+	if !strings.Contains(template, UUIDPlaceholder) && !strings.Contains(template, IdentifierValuePlaceholder) {
+		return fmt.Errorf("Metadata URL %s needs a placeholder for %s or %s", template, UUIDPlaceholder, IdentifierValuePlaceholder)
+	}
+	return nil
 }
 
 func NewV1MetadataReadService(cmr *Cluster) (*V1MetadataReadService, error) {
-	url := cmr.GetAddress()
-	if !strings.Contains(url, SourcePlaceholder) || !strings.Contains(url, UUIDPlaceholder) {
-		return nil, errors.New("Metadata URL is invalid")
+	err := validateURLTemplate(cmr.GetAddress())
+	if err != nil {
+		return nil, err
 	}
 
-	t := digest.NewTransport(cmr.GetUsername(), cmr.GetPassword())
-	t.Transport = &(*transport)
-	c, err := t.Client()
+	t, err := cmr.transport(AuthDigest, &(*transport))
 	if err != nil {
 		return nil, err
 	}
 	return &V1MetadataReadService{
-		client: c,
+		client: &http.Client{Transport: t, Timeout: readTimeout},
 		url:    cmr.GetAddress()}, nil
 }
 
-func (c *V1MetadataReadService) ReadByUUID(content Content) ([]byte, error) {
-	var result []byte
+// SetRetries makes reads failing with a transport error, a timeout, a 5xx or a 429 status be retried
+// up to maxRetries times, waiting backoff before the first retry and twice as long before each next one,
+// at most maxRetryBackoff
+func (c *V1MetadataReadService) SetRetries(maxRetries int, backoff time.Duration) {
+	c.maxRetries = maxRetries
+	c.backoff = backoff
+}
+
+// SetSourceURLs makes the reader read the metadata of the given sources from their own URL templates
+func (c *V1MetadataReadService) SetSourceURLs(templates map[string]string) error {
+	for source, template := range templates {
+		if !isKnownSource(source) {
+			return fmt.Errorf("Unknown source %s for metadata URL %s", source, template)
+		}
+		err := validateURLTemplate(template)
+		if err != nil {
+			return err
+		}
+	}
+	c.sourceURLs = templates
+	return nil
+}
+
+// SetSchema makes the reader refuse metadata not following the schema, on top of anything that is not V1 metadata
+func (c *V1MetadataReadService) SetSchema(schema *MetadataSchema) {
+	c.schema = schema
+}
+
+// InjectFaults makes the requests to the binding service fail as configured, for resilience testing
+func (c *V1MetadataReadService) InjectFaults(config FaultConfig) {
+	c.client.Transport = NewFaultTransport(c.client.Transport, config)
+}
+
+func (c *V1MetadataReadService) ReadByUUID(content Content, run ReadRun) ([]byte, error) {
 	url, err := c.buildURL(content)
 	if err != nil {
-		log.Errorf("Error while building metadata URL: %s", err)
-		return result, err
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		result, err := c.read(content, run, url)
+		if err == nil || !isUnavailable(err) || attempt >= c.maxRetries {
+			return result, err
+		}
+		delay := retryDelay(c.backoff, attempt)
+		retries.WithLabelValues(stageRead).Inc()
+		contentLog(run.ID, content, stageRead).WithError(err).WithField("attempt", attempt+1).Warningf("Retrying metadata read in %s", delay)
+		select {
+		case <-time.After(delay):
+		case <-run.Cancelled:
+			return result, err
+		}
 	}
+}
 
+// retryDelay doubles the backoff for every previous retry, capped so that it cannot overflow
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	delay := backoff
+	for i := 0; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return delay
+}
+
+func (c *V1MetadataReadService) read(content Content, run ReadRun, url string) ([]byte, error) {
+	var result []byte
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return result, err
 	}
 	req.Header.Add("ClientUserPrincipal", "upp")
 
+	start := time.Now()
 	resp, err := c.client.Do(req)
+	status := statusLabel(resp)
+	bindingServiceRequests.WithLabelValues(status).Inc()
+	bindingServiceLatency.WithLabelValues(status).Observe(time.Since(start).Seconds())
+	logger := contentLog(run.ID, content, stageRead).WithField(durationField, durationMillis(start))
 	if err != nil {
-		j, _ := json.Marshal(content)
-		log.Errorf("Getting metadata failed: %s", err)
-		return result, fmt.Errorf("Failed to get metadata for content=[%s]", j)
+		logger.WithError(err).Warning("Getting metadata failed")
+		return result, upstreamError(stageRead, "Failed to get metadata: %s", err)
 	}
 	defer resp.Body.Close()
+	logger = logger.WithField(statusCodeField, resp.StatusCode)
 
 	//if status is 204 means that there is no metadata for this piece of content
 	if resp.StatusCode == http.StatusNoContent {
-		j, _ := json.Marshal(content)
-		log.Warningf("Received response with status code %d from binding service for content=[%s]", resp.StatusCode, j)
-		return result, nil
+		bindingServiceNoMetadata.Inc()
+		logger.Debug("Received no metadata from binding service")
+		return nil, ErrNoMetadata
 	}
 	if resp.StatusCode != http.StatusOK {
-		j, _ := json.Marshal(content)
-		return result, fmt.Errorf("Received response with status code %d from binding service for content=[%s]", resp.StatusCode, j)
+		logger.Warning("Received unexpected response from binding service")
+		return result, statusError(stageRead, resp.StatusCode, "binding service")
 	}
 	result, err = ioutil.ReadAll(resp.Body)
-	return result, err
+	if err != nil {
+		return result, upstreamError(stageRead, "Failed to read metadata: %s", err)
+	}
+	//an empty body means no metadata, as with 204
+	if len(result) == 0 {
+		return nil, ErrNoMetadata
+	}
+	err = validateMetadata(content, result, c.schema)
+	if err != nil {
+		if ie, ok := err.(*InvalidMetadataError); ok {
+			invalidMetadata.WithLabelValues(ie.Category).Inc()
+		}
+		logger.WithError(err).Warning("Received invalid metadata from binding service")
+		return nil, err
+	}
+	return result, nil
 }
 
 func (c *V1MetadataReadService) buildURL(content Content) (string, error) {
 	source, ok := content.getSource()
 	if !ok {
-		j, _ := json.Marshal(content)
-		return "", fmt.Errorf("Cannot get source of content=[%s]", j)
+		return "", &ContentError{Kind: ErrorInvalidSource, Stage: stageRead, Msg: fmt.Sprintf("Cannot get source of content %s", content.UUID)}
+	}
+
+	template, ok := c.sourceURLs[source]
+	if !ok {
+		template = c.url
+	}
+	id := content.Identifiers[0]
+	if strings.Contains(template, IdentifierValuePlaceholder) && id.IdentifierValue == "" {
+		return "", &ContentError{Kind: ErrorInvalidSource, Stage: stageRead, Msg: fmt.Sprintf("No identifier value for content %s", content.UUID)}
 	}
 
-	url := strings.Replace(c.url, SourcePlaceholder, source, -1)
+	url := strings.Replace(template, SourcePlaceholder, source, -1)
 	url = strings.Replace(url, UUIDPlaceholder, content.UUID, -1)
+	url = replaceEscaped(url, AuthorityPlaceholder, id.Authority)
+	url = replaceEscaped(url, SystemCodePlaceholder, path.Base(id.Authority))
+	url = replaceEscaped(url, IdentifierValuePlaceholder, id.IdentifierValue)
 	return url, nil
+}
 
+// replaceEscaped substitutes the placeholder with the value escaped for its position in the URL: as a path segment
+// before the query, as a query component after it; escaped values contain no '?', so the query keeps starting
+// at the same '?' of the template
+func replaceEscaped(url string, placeholder string, value string) string {
+	query := strings.Index(url, "?")
+	if query < 0 {
+		return strings.Replace(url, placeholder, neturl.PathEscape(value), -1)
+	}
+	return strings.Replace(url[:query], placeholder, neturl.PathEscape(value), -1) +
+		strings.Replace(url[query:], placeholder, neturl.QueryEscape(value), -1)
 }
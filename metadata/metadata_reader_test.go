@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 
 	"io/ioutil"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -40,7 +41,7 @@ func TestReadByUUIDSuccessful(t *testing.T) {
 	reader, err := NewV1MetadataReadService(&cmr)
 	assert.NoError(t, err, "Failed to initialise metadata reader")
 
-	result, err := reader.ReadByUUID(testContent)
+	result, err := reader.ReadByUUID(testContent, ReadRun{})
 	assert.NoError(t, err, "Failed to read metadata")
 	assert.Equal(t, expectedResponse, result, "Actual metadata differs from expected metadata")
 
@@ -53,8 +54,6 @@ func TestReadByUUIDEmptyResponseWhenNoMetadataIsReturned(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	expectedResponse := []byte{}
-
 	cmr := Cluster{
 		address:  ts.URL + BindingServiceURL,
 		username: "foo",
@@ -62,9 +61,9 @@ func TestReadByUUIDEmptyResponseWhenNoMetadataIsReturned(t *testing.T) {
 	}
 	reader, err := NewV1MetadataReadService(&cmr)
 	assert.NoError(t, err, "Failed to initialise metadata reader")
-	result, err := reader.ReadByUUID(testContent)
-	assert.NoError(t, err, "Failed to read metadata")
-	assert.Equal(t, expectedResponse, result, "Actual metadata differs from expected metadata")
+	result, err := reader.ReadByUUID(testContent, ReadRun{})
+	assert.Equal(t, ErrNoMetadata, err, "Expecting no metadata")
+	assert.Empty(t, result, "Actual metadata differs from expected metadata")
 }
 
 func TestReadByUUIDUnsuccessful(t *testing.T) {
@@ -80,7 +79,7 @@ func TestReadByUUIDUnsuccessful(t *testing.T) {
 	}
 	reader, err := NewV1MetadataReadService(&cmr)
 	assert.NoError(t, err, "Failed to initialise metadata reader")
-	_, err = reader.ReadByUUID(testContent)
+	_, err = reader.ReadByUUID(testContent, ReadRun{})
 	assert.Error(t, err, "Getting metadata should return error")
 }
 
@@ -94,6 +93,135 @@ func TestBuildURL(t *testing.T) {
 	assert.Equal(t, expectedURL, actual, "Result URL is different from expected URL")
 }
 
+func TestBuildURLPlaceholders(t *testing.T) {
+	blog := Content{
+		UUID:        "0cd42702-f789-11e6-9516-2d969e0d3b65",
+		Identifiers: []Identifier{{Authority: "http://api.ft.com/system/FT-LABS-WP-1-335", IdentifierValue: "http://blogs.ft.com/brusselsblog/?p=2052"}},
+	}
+	cmr := V1MetadataReadService{url: "http://localhost:8080/binding/{source}/{systemCode}/{identifierValue}?authority={authority}&uuid={uuid}"}
+	actual, err := cmr.buildURL(blog)
+	assert.NoError(t, err, "Failed to build URL")
+	assert.Equal(t, "http://localhost:8080/binding/BLOGS/FT-LABS-WP-1-335/http:%2F%2Fblogs.ft.com%2Fbrusselsblog%2F%3Fp=2052?authority=http%3A%2F%2Fapi.ft.com%2Fsystem%2FFT-LABS-WP-1-335&uuid=0cd42702-f789-11e6-9516-2d969e0d3b65", actual, "Result URL is different from expected URL")
+
+	_, err = cmr.buildURL(testContent)
+	assert.Error(t, err, "Expecting error for content without identifier value")
+}
+
+func TestBuildURLEscapesForPosition(t *testing.T) {
+	content := Content{
+		UUID:        "0cd42702-f789-11e6-9516-2d969e0d3b65",
+		Identifiers: []Identifier{{Authority: "http://api.ft.com/system/FT LABS", IdentifierValue: "a b/c"}},
+	}
+	cmr := V1MetadataReadService{url: "http://localhost:8080/binding/{authority}/{identifierValue}?authority={authority}&id={identifierValue}"}
+	actual, err := cmr.buildURL(content)
+	assert.NoError(t, err, "Failed to build URL")
+	assert.Equal(t, "http://localhost:8080/binding/http:%2F%2Fapi.ft.com%2Fsystem%2FFT%20LABS/a%20b%2Fc?authority=http%3A%2F%2Fapi.ft.com%2Fsystem%2FFT+LABS&id=a+b%2Fc", actual, "Unexpected escaping")
+}
+
+func TestBuildURLSourceTemplates(t *testing.T) {
+	cmr := V1MetadataReadService{url: "http://localhost:8080" + BindingServiceURL}
+	assert.NoError(t, cmr.SetSourceURLs(map[string]string{"BLOGS": "http://wordpress:8080/{systemCode}/{uuid}"}), "Failed to set source URLs")
+	assert.Error(t, cmr.SetSourceURLs(map[string]string{"VIDEO": "http://video:8080/{uuid}"}), "Expecting error for unknown source")
+
+	actual, err := cmr.buildURL(Content{UUID: "0cd42702-f789-11e6-9516-2d969e0d3b65", Identifiers: []Identifier{{Authority: "http://api.ft.com/system/FT-CLAMO"}}})
+	assert.NoError(t, err, "Failed to build URL")
+	assert.Equal(t, "http://wordpress:8080/FT-CLAMO/0cd42702-f789-11e6-9516-2d969e0d3b65", actual, "Source template should be used")
+
+	actual, err = cmr.buildURL(testContent)
+	assert.NoError(t, err, "Failed to build URL")
+	assert.Equal(t, "http://localhost:8080/metadata-services/binding/1.0/sources/METHODE/references/0cd42702-f789-11e6-9516-2d969e0d3b65", actual, "Default template should be used for other sources")
+}
+
+func TestValidateURLTemplate(t *testing.T) {
+	assert.NoError(t, validateURLTemplate("http://localhost:8080"+BindingServiceURL), "Expecting valid template")
+	assert.NoError(t, validateURLTemplate("http://localhost:8080/{systemCode}/{identifierValue}"), "Source should not be required")
+	assert.Error(t, validateURLTemplate("http://localhost:8080/{source}"), "Expecting error for template not identifying the content")
+	assert.Error(t, validateURLTemplate("http://localhost:8080/{source}/{uuid}/{version}"), "Expecting error for unknown placeholder")
+}
+
 func getMetadata() ([]byte, error) {
 	return ioutil.ReadFile("resources/metadata-response.xml")
 }
+
+func TestReadByUUIDRetriesUnavailableService(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		m, _ := getMetadata()
+		w.Write(m)
+	}))
+	defer ts.Close()
+
+	reader, err := NewV1MetadataReadService(&Cluster{address: ts.URL + BindingServiceURL})
+	assert.NoError(t, err, "Failed to initialise metadata reader")
+	reader.SetRetries(3, time.Millisecond)
+
+	result, err := reader.ReadByUUID(testContent, ReadRun{})
+	assert.NoError(t, err, "Read should succeed after retrying")
+	assert.NotEmpty(t, result, "Expecting metadata")
+	assert.Equal(t, 3, requests, "Unexpected number of requests")
+}
+
+func TestReadByUUIDGivesUpAfterRetries(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	reader, err := NewV1MetadataReadService(&Cluster{address: ts.URL + BindingServiceURL})
+	assert.NoError(t, err, "Failed to initialise metadata reader")
+	reader.SetRetries(2, time.Millisecond)
+
+	_, err = reader.ReadByUUID(testContent, ReadRun{})
+	assert.True(t, isUnavailable(err), "Expecting the binding service to be reported unavailable, got %v", err)
+	assert.Equal(t, 3, requests, "Unexpected number of requests")
+}
+
+func TestReadByUUIDDoesNotRetryClientErrors(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	reader, err := NewV1MetadataReadService(&Cluster{address: ts.URL + BindingServiceURL})
+	assert.NoError(t, err, "Failed to initialise metadata reader")
+	reader.SetRetries(3, time.Millisecond)
+
+	_, err = reader.ReadByUUID(testContent, ReadRun{})
+	assert.Error(t, err, "Expecting error for a missing content")
+	assert.False(t, isUnavailable(err), "A 404 does not mean that the binding service is unavailable")
+	assert.Equal(t, 1, requests, "Client errors should not be retried")
+}
+
+func TestReadByUUIDStopsRetryingWhenCancelled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	reader, err := NewV1MetadataReadService(&Cluster{address: ts.URL + BindingServiceURL})
+	assert.NoError(t, err, "Failed to initialise metadata reader")
+	reader.SetRetries(3, time.Hour)
+
+	cancelled := make(chan struct{})
+	close(cancelled)
+	start := time.Now()
+	_, err = reader.ReadByUUID(testContent, ReadRun{Cancelled: cancelled})
+	assert.True(t, isUnavailable(err), "Expecting the last failure, got %v", err)
+	assert.True(t, time.Since(start) < time.Minute, "The wait for the retry should stop when cancelled")
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Second, retryDelay(time.Second, 0), "Unexpected first delay")
+	assert.Equal(t, 4*time.Second, retryDelay(time.Second, 2), "Unexpected third delay")
+	assert.Equal(t, maxRetryBackoff, retryDelay(time.Second, 100), "The delay should be capped")
+	assert.Equal(t, maxRetryBackoff, retryDelay(time.Second, 1000000), "The delay should be capped")
+}
@@ -0,0 +1,160 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+)
+
+const contentRefNamespace = "http://metadata.internal.ft.com/metadata/xsd/metadata_content_reference_v1.0.xsd"
+
+// Categories of invalid metadata
+const (
+	InvalidMalformed  = "malformed"
+	InvalidUnexpected = "unexpected_document"
+	InvalidSchema     = "schema"
+)
+
+// ContentRef is the V1 metadata of a content item as returned by the binding service
+type ContentRef struct {
+	XMLName            xml.Name            `xml:"contentRef"`
+	ID                 string              `xml:"id,attr"`
+	Created            string              `xml:"created,attr"`
+	PrimarySection     *Term               `xml:"primarySection"`
+	PrimaryTheme       *Term               `xml:"primaryTheme"`
+	Tags               []Tag               `xml:"tags>tag"`
+	ExternalReferences []ExternalReference `xml:"externalReferences>reference"`
+}
+
+// Tag links the content to a term of a taxonomy, with scores out of 100
+type Tag struct {
+	Meta  TagMeta `xml:"meta"`
+	Term  Term    `xml:"term"`
+	Score Score   `xml:"score"`
+}
+
+// TagMeta says where the tag comes from, e.g. INLINE for tags found in the text
+type TagMeta struct {
+	Provenance string `xml:"provenance,attr"`
+}
+
+// Term is a concept of a taxonomy, identified by its ID across taxonomies
+type Term struct {
+	ID             string `xml:"id,attr"`
+	Status         string `xml:"status,attr"`
+	ExternalTermID string `xml:"externalTermId,attr"`
+	Taxonomy       string `xml:"taxonomy,attr"`
+	CanonicalName  string `xml:"canonicalName"`
+}
+
+type Score struct {
+	Frequency  int `xml:"frequency,attr"`
+	Relevance  int `xml:"relevance,attr"`
+	Confidence int `xml:"confidence,attr"`
+}
+
+type ExternalReference struct {
+	ExternalID     string `xml:"externalId,attr"`
+	ExternalSource string `xml:"externalSource,attr"`
+}
+
+// InvalidMetadataError means that the binding service answered with something that is not V1 metadata,
+// or with metadata not complying with the configured schema
+type InvalidMetadataError struct {
+	Category string
+	Reason   string
+}
+
+func (e *InvalidMetadataError) Error() string {
+	return fmt.Sprintf("Invalid metadata (%s): %s", e.Category, e.Reason)
+}
+
+// MetadataSchema holds optional rules that the metadata must follow to be published
+type MetadataSchema struct {
+	// MaxSize is the maximum size of the metadata in bytes, 0 meaning no limit
+	MaxSize int `json:"maxSize"`
+	// RequireTags refuses metadata without any tag
+	RequireTags bool `json:"requireTags"`
+	// Taxonomies lists the taxonomies allowed for the tagged terms, any taxonomy being allowed if empty
+	Taxonomies []string `json:"taxonomies"`
+	// RequireReference refuses metadata whose external references do not include the content
+	RequireReference bool `json:"requireReference"`
+}
+
+// LoadMetadataSchema reads the schema from a JSON file
+func LoadMetadataSchema(path string) (*MetadataSchema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schema MetadataSchema
+	err = json.Unmarshal(data, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid metadata schema file %s: %s", path, err)
+	}
+	return &schema, nil
+}
+
+// parseMetadata reads the V1 metadata XML, refusing anything else such as an HTML error page
+func parseMetadata(metadata []byte) (*ContentRef, error) {
+	var ref ContentRef
+	decoder := xml.NewDecoder(bytes.NewReader(metadata))
+	err := decoder.Decode(&ref)
+	if err != nil {
+		if _, ok := err.(xml.UnmarshalError); ok {
+			return nil, &InvalidMetadataError{Category: InvalidUnexpected, Reason: err.Error()}
+		}
+		return nil, &InvalidMetadataError{Category: InvalidMalformed, Reason: err.Error()}
+	}
+	if ref.XMLName.Space != contentRefNamespace {
+		return nil, &InvalidMetadataError{Category: InvalidUnexpected, Reason: fmt.Sprintf("Unexpected root element %s in namespace %q", ref.XMLName.Local, ref.XMLName.Space)}
+	}
+	return &ref, nil
+}
+
+// validateMetadata checks that the metadata of the content is V1 metadata complying with the schema, if there is one
+func validateMetadata(content Content, metadata []byte, schema *MetadataSchema) error {
+	ref, err := parseMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		return nil
+	}
+	if schema.MaxSize > 0 && len(metadata) > schema.MaxSize {
+		return &InvalidMetadataError{Category: InvalidSchema, Reason: fmt.Sprintf("Metadata of %d bytes exceeds the maximum of %d", len(metadata), schema.MaxSize)}
+	}
+	if schema.RequireTags && len(ref.Tags) == 0 {
+		return &InvalidMetadataError{Category: InvalidSchema, Reason: "No tags"}
+	}
+	if len(schema.Taxonomies) > 0 {
+		for _, tag := range ref.Tags {
+			if !contains(schema.Taxonomies, tag.Term.Taxonomy) {
+				return &InvalidMetadataError{Category: InvalidSchema, Reason: fmt.Sprintf("Term %s has unexpected taxonomy %q", tag.Term.ID, tag.Term.Taxonomy)}
+			}
+		}
+	}
+	if schema.RequireReference {
+		found := false
+		for _, r := range ref.ExternalReferences {
+			if r.ExternalID == content.UUID {
+				found = true
+			}
+		}
+		if !found {
+			return &InvalidMetadataError{Category: InvalidSchema, Reason: fmt.Sprintf("No external reference to content %s", content.UUID)}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package metadata
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const maintenancePage = `<html><head><title>Maintenance</title></head><body><p>Back soon<br></p></body></html>`
+
+var fixtureContent = Content{UUID: "4fad74e8-056c-11e7-ace0-1ce02ef0def9"}
+
+func assertInvalid(t *testing.T, err error, category string) {
+	if assert.Error(t, err, "Expecting invalid metadata") {
+		invalid, ok := err.(*InvalidMetadataError)
+		if assert.True(t, ok, "Expecting InvalidMetadataError, got %T", err) {
+			assert.Equal(t, category, invalid.Category, "Unexpected error category")
+		}
+	}
+}
+
+func TestValidateMetadata(t *testing.T) {
+	metadata, err := getMetadata()
+	assert.NoError(t, err, "Failed to read metadata fixture")
+
+	assert.NoError(t, validateMetadata(fixtureContent, metadata, nil), "Fixture should be valid metadata")
+	assert.NoError(t, validateMetadata(fixtureContent, metadata, &MetadataSchema{RequireTags: true, Taxonomies: []string{"Authors"}, RequireReference: true}), "Fixture should comply with the schema")
+}
+
+func TestValidateMetadataRefusesOtherDocuments(t *testing.T) {
+	metadata, err := getMetadata()
+	assert.NoError(t, err, "Failed to read metadata fixture")
+
+	assertInvalid(t, validateMetadata(testContent, []byte(maintenancePage), nil), InvalidUnexpected)
+	assertInvalid(t, validateMetadata(testContent, []byte("Service Unavailable"), nil), InvalidMalformed)
+	assertInvalid(t, validateMetadata(testContent, metadata[:len(metadata)/2], nil), InvalidMalformed)
+	assertInvalid(t, validateMetadata(testContent, []byte(`<?xml version="1.0"?><error>Timed out</error>`), nil), InvalidUnexpected)
+	assertInvalid(t, validateMetadata(testContent, []byte(`<contentRef id="1"/>`), nil), InvalidUnexpected)
+}
+
+func TestValidateMetadataSchema(t *testing.T) {
+	metadata, err := getMetadata()
+	assert.NoError(t, err, "Failed to read metadata fixture")
+	untagged := []byte(`<contentRef xmlns="` + contentRefNamespace + `" id="1"><tags/></contentRef>`)
+
+	assertInvalid(t, validateMetadata(fixtureContent, metadata, &MetadataSchema{MaxSize: 100}), InvalidSchema)
+	assertInvalid(t, validateMetadata(fixtureContent, untagged, &MetadataSchema{RequireTags: true}), InvalidSchema)
+	assertInvalid(t, validateMetadata(fixtureContent, metadata, &MetadataSchema{Taxonomies: []string{"Topics"}}), InvalidSchema)
+	assertInvalid(t, validateMetadata(testContent, metadata, &MetadataSchema{RequireReference: true}), InvalidSchema)
+	assert.NoError(t, validateMetadata(fixtureContent, untagged, &MetadataSchema{}), "Tags should only be required by the schema")
+}
+
+func TestLoadMetadataSchema(t *testing.T) {
+	f, err := ioutil.TempFile("", "schema")
+	assert.NoError(t, err, "Failed to create schema file")
+	defer os.Remove(f.Name())
+	f.WriteString(`{"maxSize": 65536, "requireTags": true, "taxonomies": ["Authors", "Topics"]}`)
+	f.Close()
+
+	schema, err := LoadMetadataSchema(f.Name())
+	assert.NoError(t, err, "Failed to load schema")
+	assert.Equal(t, &MetadataSchema{MaxSize: 65536, RequireTags: true, Taxonomies: []string{"Authors", "Topics"}}, schema, "Unexpected schema")
+
+	_, err = LoadMetadataSchema("resources/metadata-response.xml")
+	assert.Error(t, err, "Expecting error for a schema file which is not JSON")
+}
+
+func TestReadByUUIDRefusesInvalidMetadata(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(maintenancePage))
+	}))
+	defer ts.Close()
+
+	reader, err := NewV1MetadataReadService(&Cluster{address: ts.URL + BindingServiceURL})
+	assert.NoError(t, err, "Failed to initialise metadata reader")
+	reader.SetRetries(2, 0)
+	result, err := reader.ReadByUUID(testContent, ReadRun{})
+	assertInvalid(t, err, InvalidUnexpected)
+	assert.Nil(t, result, "No metadata expected")
+	assert.False(t, isUnavailable(err), "Invalid metadata should not count as the binding service being down")
+	assert.Equal(t, 1, requests, "Invalid metadata should not be retried")
+}
+
+func TestPublishNeverSendsInvalidMetadata(t *testing.T) {
+	contents := testContents(4, methodeAuthority, 0)
+	h := newHarness(t, contents, RateLimits{BatchSize: 5})
+	defer h.Close()
+	h.bindingService.invalid[contents[2].UUID] = true
+
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 5})
+	err := h.mp.PublishBackfill(b)
+	assert.NoError(t, err, "Backfill should finish without error")
+
+	status := b.Status()
+	assert.Equal(t, int64(3), status.Published, "Unexpected number of published contents")
+	assert.Equal(t, int64(1), status.Failed, "Invalid metadata should be counted as failed")
+	assert.Equal(t, uuidsOf([]Content{contents[0], contents[1], contents[3]}), h.notifier.receivedUUIDs(), "Invalid metadata should never reach the notifier")
+}
@@ -0,0 +1,118 @@
+package metadata
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "v1_metadata_publisher"
+
+var (
+	mongoDocumentsScanned = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "mongo_documents_scanned_total",
+		Help:      "Number of content documents read from Mongo.",
+	})
+
+	mongoDocumentsMatched = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "mongo_documents_matched_total",
+		Help:      "Number of content documents read from Mongo that matched the selected source.",
+	})
+
+	bindingServiceRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "binding_service_requests_total",
+		Help:      "Number of requests sent to the binding service by response status.",
+	}, []string{"status"})
+
+	bindingServiceLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "binding_service_request_duration_seconds",
+		Help:      "Latency of requests sent to the binding service by response status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status"})
+
+	bindingServiceNoMetadata = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "binding_service_no_metadata_total",
+		Help:      "Number of 204 responses from the binding service, meaning the content has no metadata.",
+	})
+
+	invalidMetadata = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "invalid_metadata_total",
+		Help:      "Number of binding service responses refused as invalid metadata by category.",
+	}, []string{"category"})
+
+	metadataCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "metadata_cache_requests_total",
+		Help:      "Number of metadata cache lookups by result (hit, miss, expired or bypass).",
+	}, []string{"result"})
+
+	notifierPublishes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "notifier_publishes_total",
+		Help:      "Number of metadata publishes sent to the notifier by response status.",
+	}, []string{"status"})
+
+	notifierLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "notifier_publish_duration_seconds",
+		Help:      "Latency of metadata publishes sent to the notifier by response status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"status"})
+
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retries_total",
+		Help:      "Number of retried requests by pipeline stage.",
+	}, []string{"stage"})
+
+	circuitOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "binding_service_circuit_open",
+		Help:      "1 while reads are paused because the binding service is failing, 0 otherwise.",
+	})
+
+	inFlightWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "in_flight_workers",
+		Help:      "Number of content items currently being read or published.",
+	})
+
+	throttleRate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "throttle_rate_per_second",
+		Help:      "Current number of content items started per second.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		mongoDocumentsScanned,
+		mongoDocumentsMatched,
+		bindingServiceRequests,
+		bindingServiceLatency,
+		bindingServiceNoMetadata,
+		invalidMetadata,
+		metadataCacheRequests,
+		notifierPublishes,
+		notifierLatency,
+		retries,
+		circuitOpen,
+		inFlightWorkers,
+		throttleRate,
+	)
+}
+
+// statusLabel returns the label used for a response status, or "error" when no response was received
+func statusLabel(resp *http.Response) string {
+	if resp == nil {
+		return "error"
+	}
+	return strconv.Itoa(resp.StatusCode)
+}
@@ -0,0 +1,185 @@
+package metadata
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type pipelineItem struct {
+	seq      int
+	content  Content
+	metadata []byte
+}
+
+// pipeline reads metadata from the binding service and publishes it to the notifier in separate stages,
+// connected by bounded queues so that a slow stage holds back the stages before it instead of idling them
+type pipeline struct {
+	mp        *V1MetadataPublishService
+	stats     *jobStats
+	errorsCh  chan error
+	cancelled <-chan struct{}
+	completed func(seq int)
+	reads     chan pipelineItem
+	publishes chan pipelineItem
+	done      chan struct{}
+}
+
+// startPipeline starts the stages; failures are sent to errorsCh if not nil, and completed is called
+// with the sequence number of every item that went through, unless it was dropped on cancellation
+func (mp *V1MetadataPublishService) startPipeline(stats *jobStats, errorsCh chan error, cancelled <-chan struct{}, completed func(seq int)) *pipeline {
+	size := mp.limits.get().queueSize()
+	p := &pipeline{
+		mp:        mp,
+		stats:     stats,
+		errorsCh:  errorsCh,
+		cancelled: cancelled,
+		completed: completed,
+		reads:     make(chan pipelineItem, size),
+		publishes: make(chan pipelineItem, size),
+		done:      make(chan struct{}),
+	}
+	go p.dispatchReads()
+	go p.dispatchPublishes()
+	return p
+}
+
+// submit queues the content for reading, blocking while the queue is full
+func (p *pipeline) submit(seq int, content Content) {
+	p.reads <- pipelineItem{seq: seq, content: content}
+}
+
+// close waits until the submitted content went through all the stages
+func (p *pipeline) close() {
+	close(p.reads)
+	<-p.done
+}
+
+func (p *pipeline) isCancelled() bool {
+	select {
+	case <-p.cancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *pipeline) dispatchReads() {
+	var wg sync.WaitGroup
+	for item := range p.reads {
+		if p.isCancelled() {
+			continue
+		}
+		p.mp.limits.paceRead()
+		p.mp.limits.acquire()
+		inFlightWorkers.Inc()
+		wg.Add(1)
+		go func(item pipelineItem) {
+			defer wg.Done()
+			//the read slot is only released once the publish queue took the item, which holds back reads while publishing is slow
+			defer p.mp.limits.release()
+			p.read(item)
+		}(item)
+	}
+	wg.Wait()
+	close(p.publishes)
+}
+
+func (p *pipeline) read(item pipelineItem) {
+	runID := p.stats.runID
+	if !p.mp.breaker.wait(p.cancelled) {
+		inFlightWorkers.Dec()
+		return
+	}
+	value, err := p.mp.mr.ReadByUUID(item.content, ReadRun{ID: runID, Cancelled: p.cancelled})
+	p.mp.breaker.record(err)
+	if err != nil && err != ErrNoMetadata {
+		contentLog(runID, item.content, stageRead).WithError(err).WithField(errorKindField, errorKind(err)).Error("Reading metadata failed")
+		p.mp.recordAttempt(runID, item.content, "", nil, err)
+		p.fail(item, err)
+		return
+	}
+	if err == ErrNoMetadata || len(value) == 0 {
+		contentLog(runID, item.content, stageRead).Info("No metadata for content")
+		p.mp.recordAttempt(runID, item.content, "", nil, nil)
+		atomic.AddInt64(&p.stats.noMetadata, 1)
+		p.complete(item)
+		return
+	}
+	item.metadata = value
+	p.publishes <- item
+}
+
+func (p *pipeline) dispatchPublishes() {
+	var wg sync.WaitGroup
+	for item := range p.publishes {
+		if p.isCancelled() {
+			inFlightWorkers.Dec()
+			continue
+		}
+		p.mp.limits.pacePublish()
+		p.mp.limits.acquirePublish()
+		wg.Add(1)
+		go func(item pipelineItem) {
+			defer wg.Done()
+			defer p.mp.limits.releasePublish()
+			p.publish(item)
+		}(item)
+	}
+	wg.Wait()
+	close(p.done)
+}
+
+func (p *pipeline) publish(item pipelineItem) {
+	runID := p.stats.runID
+	tid, err := p.mp.publishMetadataForUUID(runID, item.content, item.metadata)
+	p.mp.recordAttempt(runID, item.content, tid, item.metadata, err)
+	if err != nil {
+		p.fail(item, err)
+		return
+	}
+	atomic.AddInt64(&p.stats.published, 1)
+	p.complete(item)
+}
+
+func (p *pipeline) fail(item pipelineItem, err error) {
+	p.mp.recordFailure(p.stats, item.content, err)
+	if p.errorsCh != nil {
+		p.errorsCh <- err
+	}
+	p.complete(item)
+}
+
+func (p *pipeline) complete(item pipelineItem) {
+	inFlightWorkers.Dec()
+	if p.completed != nil {
+		p.completed(item.seq)
+	}
+}
+
+// watermark tracks the position up to which all the content has gone through the pipeline,
+// so that a backfill resumed from that position does not miss anything
+type watermark struct {
+	mu        sync.Mutex
+	position  int
+	done      map[int]bool
+	onAdvance func(position int)
+}
+
+func newWatermark(position int, onAdvance func(position int)) *watermark {
+	return &watermark{position: position, done: map[int]bool{}, onAdvance: onAdvance}
+}
+
+func (w *watermark) complete(seq int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done[seq] = true
+	advanced := false
+	for w.done[w.position+1] {
+		delete(w.done, w.position+1)
+		w.position++
+		advanced = true
+	}
+	if advanced {
+		w.onAdvance(w.position)
+	}
+}
@@ -0,0 +1,69 @@
+package metadata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatermark(t *testing.T) {
+	positions := []int{}
+	w := newWatermark(10, func(position int) {
+		positions = append(positions, position)
+	})
+
+	w.complete(12)
+	w.complete(13)
+	assert.Empty(t, positions, "Position should not advance past content still in progress")
+	w.complete(11)
+	w.complete(14)
+	assert.Equal(t, []int{13, 14}, positions, "Unexpected positions")
+}
+
+func TestPipelineOverlapsReadsAndPublishes(t *testing.T) {
+	h := newHarness(t, testContents(10, methodeAuthority, 0), RateLimits{BatchSize: 100, MaxConcurrency: 2, PublishConcurrency: 5})
+	defer h.Close()
+	h.bindingService.latency = 100 * time.Millisecond
+	h.notifier.latency = 300 * time.Millisecond
+
+	start := time.Now()
+	err := h.mp.PublishBackfill(NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 100}))
+	assert.NoError(t, err, "Backfill should finish without error")
+
+	//reading and then publishing each item with 2 workers would take 2s
+	assert.True(t, time.Since(start) < 1500*time.Millisecond, "Reads and publishes should run in separate stages, took %s", time.Since(start))
+	assert.True(t, h.bindingService.maxInFlight <= 2, "No more than 2 concurrent reads expected, got %d", h.bindingService.maxInFlight)
+	assert.True(t, h.notifier.maxInFlight <= 5, "No more than 5 concurrent publishes expected, got %d", h.notifier.maxInFlight)
+	assert.Len(t, h.notifier.received(), 10, "All contents should be published")
+}
+
+func TestPipelineSlowPublishingHoldsBackReads(t *testing.T) {
+	h := newHarness(t, testContents(10, methodeAuthority, 0), RateLimits{BatchSize: 100, MaxConcurrency: 1, PublishConcurrency: 1, QueueSize: 1})
+	defer h.Close()
+	h.notifier.latency = 200 * time.Millisecond
+
+	done := make(chan error)
+	go func() {
+		done <- h.mp.PublishBackfill(NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 100}))
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+	//one item publishing, one in the publish queue, one waiting to be queued and one being read
+	assert.True(t, len(h.bindingService.requested()) <= 6, "Reads should wait for publishing, got %d reads", len(h.bindingService.requested()))
+	assert.NoError(t, <-done, "Backfill should finish without error")
+	assert.Len(t, h.notifier.received(), 10, "All contents should be published")
+}
+
+func TestPipelineThrottlesPublishes(t *testing.T) {
+	h := newHarness(t, testContents(6, methodeAuthority, 0), RateLimits{BatchSize: 100, PublishRate: 5})
+	defer h.Close()
+
+	start := time.Now()
+	err := h.mp.PublishBackfill(NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 100}))
+	assert.NoError(t, err, "Backfill should finish without error")
+
+	assert.True(t, time.Since(start) >= time.Second, "Publishes should be throttled, took %s", time.Since(start))
+	notifications := h.notifier.received()
+	assert.Len(t, notifications, 6, "All contents should be published")
+}
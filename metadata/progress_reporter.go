@@ -0,0 +1,129 @@
+package metadata
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gosuri/uilive"
+	"github.com/mattn/go-isatty"
+	"github.com/sirupsen/logrus"
+)
+
+const progressLogInterval = 30 * time.Second
+
+// ProgressReporter shows the progress of a backfill while it is running
+type ProgressReporter interface {
+	Report(status BackfillStatus)
+	Finish(status BackfillStatus)
+}
+
+// NewProgressReporter updates a single line when stdout is a terminal the logs are not written to,
+// and otherwise logs the status of the backfill periodically until it finishes
+func NewProgressReporter(status func() BackfillStatus) ProgressReporter {
+	return newProgressReporter(os.Stdout, log.Out, status)
+}
+
+func newProgressReporter(out *os.File, logOut io.Writer, status func() BackfillStatus) ProgressReporter {
+	//the line rewrites would garble log records written to the same terminal
+	if logOut != out && (isatty.IsTerminal(out.Fd()) || isatty.IsCygwinTerminal(out.Fd())) {
+		return newTTYProgressReporter(out)
+	}
+	return newLogProgressReporter(progressLogInterval, status)
+}
+
+type ttyProgressReporter struct {
+	writer *uilive.Writer
+}
+
+func newTTYProgressReporter(out io.Writer) *ttyProgressReporter {
+	writer := uilive.New()
+	writer.Out = out
+	writer.Start()
+	return &ttyProgressReporter{writer: writer}
+}
+
+func (r *ttyProgressReporter) Report(status BackfillStatus) {
+	fmt.Fprintf(r.writer, "%d content items processed (%d published, %d without metadata, %d failed) in %.0f minutes, %.1f items/s%s\n",
+		status.Position, status.Published, status.NoMetadata, status.Failed, time.Since(status.StartedAt).Minutes(), status.Rate, etaSuffix(status))
+}
+
+func (r *ttyProgressReporter) Finish(status BackfillStatus) {
+	if status.State == BackfillCancelled {
+		fmt.Fprintf(r.writer, "\nCancelled: backfill %s stopped at position %d for source %s\n", status.ID, status.Position, status.Options.Source)
+	} else if status.State == BackfillFailed {
+		fmt.Fprintf(r.writer, "\nFailed: backfill %s stopped at position %d for source %s: %s\n", status.ID, status.Position, status.Options.Source, status.Error)
+	} else {
+		fmt.Fprintf(r.writer, "\nFinished: %d contents published for source %s\n", status.Published, status.Options.Source)
+	}
+	r.writer.Stop()
+}
+
+func etaSuffix(status BackfillStatus) string {
+	if status.ETA == "" {
+		return ""
+	}
+	return fmt.Sprintf(", %.1f%% done, ETA %s", status.Percent, status.ETA)
+}
+
+// logProgressReporter logs on its own ticker rather than when items are submitted, so that the progress
+// keeps being logged while the backfill is paused, waiting for the circuit breaker or sleeping
+type logProgressReporter struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newLogProgressReporter(interval time.Duration, status func() BackfillStatus) *logProgressReporter {
+	r := &logProgressReporter{stop: make(chan struct{}), done: make(chan struct{})}
+	go r.run(interval, status)
+	return r
+}
+
+func (r *logProgressReporter) run(interval time.Duration, status func() BackfillStatus) {
+	defer close(r.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			progressLog(status()).Info("Backfill progress")
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Report does nothing, the progress being logged by the ticker
+func (r *logProgressReporter) Report(status BackfillStatus) {}
+
+func (r *logProgressReporter) Finish(status BackfillStatus) {
+	close(r.stop)
+	<-r.done
+	if status.State == BackfillFailed {
+		progressLog(status).WithField("error", status.Error).Error("Backfill failed")
+		return
+	}
+	progressLog(status).Infof("Backfill %s", status.State)
+}
+
+func progressLog(status BackfillStatus) *logrus.Entry {
+	fields := logrus.Fields{
+		runIDField:    status.ID,
+		sourceField:   status.Options.Source,
+		stageField:    stageBackfill,
+		"state":       status.State,
+		"position":    status.Position,
+		"published":   status.Published,
+		"no_metadata": status.NoMetadata,
+		"failed":      status.Failed,
+		"rate":        status.Rate,
+	}
+	if status.Percent > 0 {
+		fields["percent"] = status.Percent
+	}
+	if status.ETA != "" {
+		fields["eta"] = status.ETA
+	}
+	return log.WithFields(fields)
+}
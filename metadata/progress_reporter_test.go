@@ -0,0 +1,41 @@
+package metadata
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogProgressReporterLogsWhileStalled(t *testing.T) {
+	hook := test.NewLocal(log)
+	defer hook.Reset()
+
+	b := NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 10, Total: 100})
+	b.setPosition(10)
+	b.Pause()
+	r := newLogProgressReporter(10*time.Millisecond, b.Status)
+	time.Sleep(100 * time.Millisecond)
+
+	b.Cancel()
+	b.finish(nil)
+	r.Finish(b.Status())
+	entries := hook.AllEntries()
+	assert.True(t, len(entries) >= 3, "Progress should be logged periodically without reports, got %d records", len(entries))
+	assert.Equal(t, 10, entries[0].Data["position"], "Unexpected position field")
+	assert.Equal(t, b.ID, entries[0].Data[runIDField], "Unexpected run ID field")
+	assert.Equal(t, BackfillCancelled, hook.LastEntry().Data["state"], "The end of a backfill should always be logged")
+
+	count := len(hook.AllEntries())
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, hook.AllEntries(), count, "Nothing should be logged once the backfill finished")
+}
+
+func TestProgressReporterLogsWhenLogsShareTheOutput(t *testing.T) {
+	b := NewBackfill(PublishOptions{})
+	r := newProgressReporter(os.Stdout, os.Stdout, b.Status)
+	assert.IsType(t, &logProgressReporter{}, r, "Expecting log records when the logs are written to the same output")
+	r.Finish(b.Status())
+}
@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProgressInterval = 2 * time.Second
+	// minProgressInterval keeps clients from making the stream send status events continuously
+	minProgressInterval = time.Second
+	failureBufferSize   = 100
+)
+
+type FailureEvent struct {
+	RunID string    `json:"runId,omitempty"`
+	UUID  string    `json:"uuid"`
+	Error string    `json:"error"`
+	Kind  string    `json:"kind"`
+	Time  time.Time `json:"time"`
+}
+
+// failureBroker fans out publish failures to the subscribed progress streams,
+// dropping events for subscribers that cannot keep up
+type failureBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan FailureEvent]bool
+}
+
+func newFailureBroker() *failureBroker {
+	return &failureBroker{subscribers: map[chan FailureEvent]bool{}}
+}
+
+func (b *failureBroker) subscribe() (<-chan FailureEvent, func()) {
+	ch := make(chan FailureEvent, failureBufferSize)
+	b.mu.Lock()
+	b.subscribers[ch] = true
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (b *failureBroker) publish(event FailureEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// ProgressStream sends the status of the current backfill periodically and every publish failure as server-sent events
+func (h *HttpHandler) ProgressStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONMessage(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	interval := defaultProgressInterval
+	if param := r.URL.Query().Get("interval"); param != "" {
+		d, err := time.ParseDuration(param)
+		if err != nil || d <= 0 {
+			writeJSONMessage(w, http.StatusBadRequest, fmt.Sprintf("Invalid interval %q", param))
+			return
+		}
+		if d < minProgressInterval {
+			writeJSONMessage(w, http.StatusBadRequest, fmt.Sprintf("Interval %s is shorter than the minimum of %s", d, minProgressInterval))
+			return
+		}
+		interval = d
+	}
+
+	failures, unsubscribe := h.mp.SubscribeFailures()
+	defer unsubscribe()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	h.writeProgressEvent(w)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.writeProgressEvent(w)
+		case event := <-failures:
+			writeEvent(w, "failure", event)
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (h *HttpHandler) writeProgressEvent(w http.ResponseWriter) {
+	b, err := h.bm.Current()
+	if err != nil {
+		writeEvent(w, "idle", map[string]string{"message": err.Error()})
+		return
+	}
+	writeEvent(w, "progress", b.Status())
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	j, err := json.Marshal(data)
+	if err != nil {
+		log.WithError(err).Errorf("Cannot marshal %s event", event)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, j)
+}
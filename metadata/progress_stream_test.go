@@ -0,0 +1,69 @@
+package metadata
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressStreamSendsProgressAndFailures(t *testing.T) {
+	mp := &V1MetadataPublishService{failures: newFailureBroker()}
+	bm := NewBackfillManager(mp)
+	bm.current = NewBackfill(PublishOptions{Source: "METHODE", BatchSize: 10})
+	h := NewHttpHandler(mp, bm, nil, nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(h.ProgressStream))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?interval=1h")
+	assert.NoError(t, err, "Failed to connect to progress stream")
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"), "Invalid Content-Type header value")
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	assert.Equal(t, "event: progress", <-lines, "Expecting progress event when connecting")
+	assert.Contains(t, <-lines, `"state":"running"`, "Progress event should contain the backfill state")
+	<-lines
+
+	mp.recordFailure(&bm.current.jobStats, testContent, statusError(stagePublish, http.StatusTooManyRequests, "notifier"))
+	select {
+	case line := <-lines:
+		assert.Equal(t, "event: failure", line, "Expecting failure event")
+	case <-time.After(time.Second):
+		t.Fatal("No failure event was received")
+	}
+	data := <-lines
+	assert.True(t, strings.Contains(data, testContent.UUID), "Failure event should contain the UUID")
+	assert.True(t, strings.Contains(data, bm.current.ID), "Failure event should contain the run ID")
+	assert.True(t, strings.Contains(data, `"kind":"throttled"`), "Failure event should contain the kind of failure")
+}
+
+func TestProgressStreamInvalidInterval(t *testing.T) {
+	mp := &V1MetadataPublishService{failures: newFailureBroker()}
+	h := NewHttpHandler(mp, NewBackfillManager(mp), nil, nil)
+
+	w := httptest.NewRecorder()
+	h.ProgressStream(w, httptest.NewRequest("GET", "/progress/stream?interval=soon", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Unexpected status code")
+}
+
+func TestProgressStreamIntervalTooShort(t *testing.T) {
+	mp := &V1MetadataPublishService{failures: newFailureBroker()}
+	h := NewHttpHandler(mp, NewBackfillManager(mp), nil, nil)
+
+	w := httptest.NewRecorder()
+	h.ProgressStream(w, httptest.NewRequest("GET", "/progress/stream?interval=1ns", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Intervals below the minimum should be refused")
+}
@@ -0,0 +1,170 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+const defaultQueueSize = 1000
+
+// RateLimits of the pipeline stages; BatchSize is the number of binding-service reads per second,
+// concurrencies of 0 default to the batch size and a publish rate of 0 means no limit
+type RateLimits struct {
+	BatchSize          int `json:"batchSize"`
+	MaxConcurrency     int `json:"maxConcurrency"`
+	PublishRate        int `json:"publishRate"`
+	PublishConcurrency int `json:"publishConcurrency"`
+	// QueueSize is the capacity of the queues between the stages, taking effect from the next backfill
+	QueueSize int `json:"queueSize"`
+}
+
+func (l RateLimits) validate() error {
+	if l.BatchSize <= 0 {
+		return fmt.Errorf("Batch size must be positive, got %d", l.BatchSize)
+	}
+	if l.MaxConcurrency < 0 {
+		return fmt.Errorf("Max concurrency must not be negative, got %d", l.MaxConcurrency)
+	}
+	if l.PublishRate < 0 {
+		return fmt.Errorf("Publish rate must not be negative, got %d", l.PublishRate)
+	}
+	if l.PublishConcurrency < 0 {
+		return fmt.Errorf("Publish concurrency must not be negative, got %d", l.PublishConcurrency)
+	}
+	if l.QueueSize < 0 {
+		return fmt.Errorf("Queue size must not be negative, got %d", l.QueueSize)
+	}
+	return nil
+}
+
+func (l RateLimits) readConcurrency() int {
+	if l.MaxConcurrency > 0 {
+		return l.MaxConcurrency
+	}
+	return l.BatchSize
+}
+
+func (l RateLimits) publishConcurrency() int {
+	if l.PublishConcurrency > 0 {
+		return l.PublishConcurrency
+	}
+	return l.readConcurrency()
+}
+
+func (l RateLimits) queueSize() int {
+	if l.QueueSize > 0 {
+		return l.QueueSize
+	}
+	return defaultQueueSize
+}
+
+// LoadRateLimits reads rate limits from a JSON file, keeping the current values for missing fields
+func LoadRateLimits(path string, current RateLimits) (RateLimits, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return current, err
+	}
+	limits := current
+	err = json.Unmarshal(data, &limits)
+	if err != nil {
+		return current, fmt.Errorf("Invalid rate limits file %s: %s", path, err)
+	}
+	return limits, limits.validate()
+}
+
+// rateLimiter holds the rate limits that can be changed while a backfill is running,
+// paces the requests of each stage and restricts the number of concurrent requests
+type rateLimiter struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	limits      RateLimits
+	inFlight    int
+	publishing  int
+	nextRead    time.Time
+	nextPublish time.Time
+}
+
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	l := &rateLimiter{limits: limits}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *rateLimiter) get() RateLimits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limits
+}
+
+func (l *rateLimiter) set(limits RateLimits) error {
+	err := limits.validate()
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.limits = limits
+	l.mu.Unlock()
+	l.cond.Broadcast()
+	return nil
+}
+
+func (l *rateLimiter) acquire() {
+	l.mu.Lock()
+	for l.inFlight >= l.limits.readConcurrency() {
+		l.cond.Wait()
+	}
+	l.inFlight++
+	l.mu.Unlock()
+}
+
+func (l *rateLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+func (l *rateLimiter) acquirePublish() {
+	l.mu.Lock()
+	for l.publishing >= l.limits.publishConcurrency() {
+		l.cond.Wait()
+	}
+	l.publishing++
+	l.mu.Unlock()
+}
+
+func (l *rateLimiter) releasePublish() {
+	l.mu.Lock()
+	l.publishing--
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+func (l *rateLimiter) paceRead() {
+	rate := l.get().BatchSize
+	throttleRate.Set(float64(rate))
+	l.pace(&l.nextRead, rate)
+}
+
+func (l *rateLimiter) pacePublish() {
+	l.pace(&l.nextPublish, l.get().PublishRate)
+}
+
+// pace spaces out the requests to at most rate per second, waiting for the next free slot
+func (l *rateLimiter) pace(next *time.Time, rate int) {
+	if rate <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if next.Before(now) {
+		*next = now
+	}
+	slot := *next
+	*next = slot.Add(time.Second / time.Duration(rate))
+	l.mu.Unlock()
+	time.Sleep(slot.Sub(now))
+}
@@ -0,0 +1,72 @@
+package metadata
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRateLimitsKeepsMissingValues(t *testing.T) {
+	f, err := ioutil.TempFile("", "rate-limits")
+	assert.NoError(t, err, "Failed to create rate limits file")
+	defer os.Remove(f.Name())
+	f.WriteString(`{"batchSize": 5}`)
+	f.Close()
+
+	limits, err := LoadRateLimits(f.Name(), RateLimits{BatchSize: 10, MaxConcurrency: 3})
+	assert.NoError(t, err, "Failed to load rate limits")
+	assert.Equal(t, RateLimits{BatchSize: 5, MaxConcurrency: 3}, limits, "Actual rate limits differ from expected rate limits")
+}
+
+func TestLoadRateLimitsInvalidBatchSize(t *testing.T) {
+	f, err := ioutil.TempFile("", "rate-limits")
+	assert.NoError(t, err, "Failed to create rate limits file")
+	defer os.Remove(f.Name())
+	f.WriteString(`{"batchSize": 0}`)
+	f.Close()
+
+	_, err = LoadRateLimits(f.Name(), RateLimits{BatchSize: 10})
+	assert.Error(t, err, "Expecting error for a zero batch size")
+}
+
+func TestRateLimiterMaxConcurrency(t *testing.T) {
+	l := newRateLimiter(RateLimits{BatchSize: 10, MaxConcurrency: 1})
+	l.acquire()
+
+	acquired := make(chan bool)
+	go func() {
+		l.acquire()
+		acquired <- true
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Second worker should wait while max concurrency is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	err := l.set(RateLimits{BatchSize: 10, MaxConcurrency: 2})
+	assert.NoError(t, err, "Failed to change rate limits")
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Second worker should start after max concurrency was raised")
+	}
+}
+
+func TestRateLimitsDefaults(t *testing.T) {
+	limits := RateLimits{BatchSize: 10}
+	assert.Equal(t, 10, limits.readConcurrency(), "Read concurrency should default to the batch size")
+	assert.Equal(t, 10, limits.publishConcurrency(), "Publish concurrency should default to the read concurrency")
+	assert.Equal(t, defaultQueueSize, limits.queueSize(), "Unexpected default queue size")
+
+	limits = RateLimits{BatchSize: 10, MaxConcurrency: 3, PublishConcurrency: 7, QueueSize: 50}
+	assert.Equal(t, 3, limits.readConcurrency(), "Unexpected read concurrency")
+	assert.Equal(t, 7, limits.publishConcurrency(), "Unexpected publish concurrency")
+	assert.Equal(t, 50, limits.queueSize(), "Unexpected queue size")
+
+	assert.Error(t, RateLimits{BatchSize: 10, PublishRate: -1}.validate(), "Expecting error for a negative publish rate")
+}